@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"time"
+	_ "time/tzdata" // embed the timezone database for device-local delivery times
 
+	"github.com/gaulatti/signal/src/config"
 	"github.com/gaulatti/signal/src/database"
 	"github.com/gaulatti/signal/src/handlers"
 	"github.com/gaulatti/signal/src/middleware"
+	"github.com/gaulatti/signal/src/models"
 	"github.com/gaulatti/signal/src/services"
 	"github.com/gaulatti/signal/src/storage"
 	"github.com/joho/godotenv"
@@ -56,23 +60,96 @@ func main() {
 	// Initialize push notification services
 	apnsService := services.NewAPNSService(s3Service, database.DB)
 	fcmService := services.NewFCMService(s3Service, database.DB)
+	webPushConfig, err := config.GetWebPushConfig()
+	if err != nil {
+		log.Fatalf("Failed to load Web Push configuration: %v", err)
+	}
+	if webPushConfig.AllowLocalEndpoints {
+		log.Println("⚠️  Web Push endpoints on local and private addresses are allowed (development only)")
+	}
+	services.AllowLocalWebPushEndpoints(webPushConfig.AllowLocalEndpoints)
+	webPushService := services.NewWebPushService(s3Service, database.DB)
+	registry := services.NewProviderRegistry()
+	registry.Register(models.PlatformIOS, apnsService)
+	registry.Register(models.PlatformAndroid, fcmService)
+	registry.Register(models.PlatformWeb, webPushService)
+	topics := services.NewTopicManager(database.DB, fcmService)
 	log.Println("✅ Push notification services initialized")
 
+	// Start the asynchronous push queue
+	queueConfig, err := config.GetQueueConfig()
+	if err != nil {
+		log.Fatalf("Failed to load queue configuration: %v", err)
+	}
+	queue := services.NewQueue(database.DB, registry, queueConfig)
+	if err := queue.BackfillScheduledUserIDs(); err != nil {
+		log.Printf("Warning: Failed to backfill user IDs of scheduled notifications: %v", err)
+	}
+	queue.Start(context.Background())
+
 	// Seed tenants from config file if it exists
 	seedService := services.NewSeedService(database.DB)
 	if err := seedService.SeedTenantsFromFile("./config/tenants.json"); err != nil {
 		log.Printf("Warning: Failed to seed tenants: %v", err)
 	}
 
-	// Start cleanup goroutine for push service clients
+	idempotencyConfig, err := config.GetIdempotencyConfig()
+	if err != nil {
+		log.Fatalf("Failed to load idempotency configuration: %v", err)
+	}
+	idempotent := middleware.IdempotencyMiddleware(idempotencyConfig.TTL, idempotencyConfig.Lease)
+
+	rateLimitConfig, err := config.GetRateLimitConfig()
+	if err != nil {
+		log.Fatalf("Failed to load rate limit configuration: %v", err)
+	}
+	limiter := middleware.NewRateLimiter(rateLimitConfig.RefreshInterval)
+
+	// protected authenticates the tenant and applies its request rate limit
+	protected := func(next http.HandlerFunc) http.HandlerFunc {
+		return middleware.AuthMiddleware(limiter.Limit(next))
+	}
+	// pushEndpoint additionally caps the request body and enforces Idempotency-Key handling and
+	// push quotas. Replays are answered before the quota check, so a retry of a push that used the
+	// last of the quota still gets its stored response.
+	limitBody := middleware.MaxBodySize(int64(queueConfig.MaxRequestBytes))
+	pushEndpoint := func(next http.HandlerFunc) http.HandlerFunc {
+		return protected(limitBody(idempotent(limiter.Quota(next))))
+	}
+
+	retentionConfig, err := config.GetRetentionConfig()
+	if err != nil {
+		log.Fatalf("Failed to load retention configuration: %v", err)
+	}
+
+	// Start cleanup goroutine for push service clients, expired idempotency keys and delivery
+	// history past its retention
 	go func() {
 		ticker := time.NewTicker(1 * time.Hour)
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				apnsService.CleanupOldClients()
-				fcmService.CleanupOldClients()
+				registry.CleanupOldClients()
+				if purged, err := models.PurgeExpiredIdempotencyKeys(database.DB); err != nil {
+					log.Printf("Failed to purge idempotency keys: %v", err)
+				} else if purged > 0 {
+					log.Printf("Purged %d expired idempotency keys", purged)
+				}
+				if retentionConfig.PushJobs > 0 {
+					if purged, err := models.PurgeCompletedPushJobs(database.DB, time.Now().Add(-retentionConfig.PushJobs)); err != nil {
+						log.Printf("Failed to purge completed push jobs: %v", err)
+					} else if purged > 0 {
+						log.Printf("Purged %d completed push jobs", purged)
+					}
+				}
+				if retentionConfig.Deliveries > 0 {
+					if purged, err := models.PurgeOldDeliveries(database.DB, time.Now().Add(-retentionConfig.Deliveries)); err != nil {
+						log.Printf("Failed to purge old deliveries: %v", err)
+					} else if purged > 0 {
+						log.Printf("Purged %d old deliveries", purged)
+					}
+				}
 			}
 		}
 	}()
@@ -83,12 +160,30 @@ func main() {
 	})
 
 	// Protected endpoints that require authentication
-	http.HandleFunc("/register", middleware.AuthMiddleware(handlers.RegisterHandler))
-	http.HandleFunc("/push", middleware.AuthMiddleware(handlers.PushHandler))
+	http.HandleFunc("/register", protected(handlers.RegisterHandler(topics)))
+	http.HandleFunc("/devices", protected(handlers.DevicesHandler))
+	http.HandleFunc("/devices/{id}", protected(handlers.DeviceHandler))
+	http.HandleFunc("/devices/{id}/attributes", protected(handlers.DeviceAttributesHandler))
+	http.HandleFunc("/push", pushEndpoint(handlers.PushHandler(queue)))
 
 	// New push notification endpoints
-	http.HandleFunc("/push/apns", middleware.AuthMiddleware(handlers.APNSPushHandler(apnsService)))
-	http.HandleFunc("/push/fcm", middleware.AuthMiddleware(handlers.FCMPushHandler(fcmService)))
+	http.HandleFunc("/push/apns", pushEndpoint(handlers.APNSPushHandler(queue)))
+	http.HandleFunc("/push/fcm", pushEndpoint(handlers.FCMPushHandler(queue)))
+	http.HandleFunc("/push/live-activity", pushEndpoint(handlers.LiveActivityPushHandler(queue)))
+	http.HandleFunc("/webpush/vapid-public-key", protected(handlers.WebPushPublicKeyHandler(webPushService)))
+	http.HandleFunc("/live-activities/tokens", protected(handlers.LiveActivityTokenHandler))
+	http.HandleFunc("/topics/{topic}/subscribe", protected(handlers.TopicSubscribeHandler(topics)))
+	http.HandleFunc("/topics/{topic}/unsubscribe", protected(handlers.TopicUnsubscribeHandler(topics)))
+	http.HandleFunc("/users/{user_id}", protected(handlers.UserHandler(topics)))
+	http.HandleFunc("/users/{user_id}/export", protected(handlers.UserExportHandler))
+	http.HandleFunc("/templates", protected(handlers.TemplatesHandler))
+	http.HandleFunc("/templates/{template_id}", protected(handlers.TemplateHandler))
+	http.HandleFunc("/notifications", protected(handlers.NotificationsHandler))
+	http.HandleFunc("/notifications/scheduled", protected(handlers.ScheduledNotificationsHandler(queue)))
+	http.HandleFunc("/notifications/{id}", protected(handlers.NotificationHandler))
+	http.HandleFunc("/notifications/{id}/cancel", protected(handlers.CancelNotificationHandler(queue)))
+	http.HandleFunc("/dead-letters", protected(handlers.DeadLettersHandler(queue)))
+	http.HandleFunc("/dead-letters/{id}/replay", protected(handlers.DeadLetterReplayHandler(queue)))
 
 	// Get port from environment or use default
 	port := os.Getenv("PORT")
@@ -100,10 +195,31 @@ func main() {
 	log.Printf("📋 Available endpoints:")
 	log.Printf("   GET  /health     - Health check (no auth required)")
 	log.Printf("   POST /register   - Register device token (auth required)")
-	log.Printf("   POST /push       - Send generic push notification (auth required)")
-	log.Printf("   POST /push/apns  - Send APNS push notification (auth required)")
-	log.Printf("   POST /push/fcm   - Send FCM push notification (auth required)")
+	log.Printf("   DELETE /register - Unregister device by token or installation ID (auth required)")
+	log.Printf("   GET  /devices    - List devices with cursor pagination (auth required)")
+	log.Printf("   GET  /devices/{id} - Get device with attributes and tags (auth required)")
+	log.Printf("   PUT  /devices/{id}/attributes - Replace device attributes and tags (auth required)")
+	log.Printf("   POST /push       - Queue push notification to registered devices (auth required)")
+	log.Printf("   POST /push/apns  - Queue APNS push notification (auth required)")
+	log.Printf("   POST /push/fcm   - Queue FCM push notification to a device, topic or condition (auth required)")
+	log.Printf("   POST /push/live-activity - Start, update or end an iOS Live Activity (auth required)")
+	log.Printf("   GET  /webpush/vapid-public-key - Get the VAPID key browsers subscribe with (auth required)")
+	log.Printf("   POST /live-activities/tokens - Register a Live Activity push token (auth required)")
+	log.Printf("   POST /topics/{topic}/subscribe - Subscribe Android devices to an FCM topic (auth required)")
+	log.Printf("   POST /topics/{topic}/unsubscribe - Unsubscribe Android devices from an FCM topic (auth required)")
+	log.Printf("   DELETE /users/{user_id} - Erase all data stored about a user (auth required)")
+	log.Printf("   GET  /users/{user_id}/export - Export all data stored about a user (auth required)")
+	log.Printf("   GET  /templates - List notification templates (auth required)")
+	log.Printf("   GET/PUT/DELETE /templates/{template_id} - Get, create or replace, delete a template (auth required)")
+	log.Printf("   GET  /notifications - List notifications, filter with ?user_id= (auth required)")
+	log.Printf("   GET  /notifications/scheduled - List pending scheduled notifications (auth required)")
+	log.Printf("   GET  /notifications/{id} - Get notification delivery status (auth required)")
+	log.Printf("   POST /notifications/{id}/cancel - Cancel a scheduled notification (auth required)")
+	log.Printf("   GET  /dead-letters - List permanently failed deliveries (auth required)")
+	log.Printf("   POST /dead-letters/{id}/replay - Requeue a failed delivery (auth required)")
 	log.Printf("💡 Authentication: Authorization: Digest <md5(api_key + YYYY-MM-DD)>")
+	log.Printf("💡 Push endpoints accept an Idempotency-Key header (replay window: %s)", idempotencyConfig.TTL)
+	log.Printf("💡 Per-tenant rate limits and push quotas return 429 with Retry-After when exceeded")
 
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// IdempotencyConfig holds the settings for Idempotency-Key handling
+type IdempotencyConfig struct {
+	// TTL is how long a stored response can be replayed for the same key
+	TTL time.Duration
+
+	// Lease is how long a request in progress holds its key. A key left behind by a request
+	// that never completed, e.g. because the instance crashed, can be reused once it expires.
+	Lease time.Duration
+}
+
+// GetIdempotencyConfig reads idempotency settings from environment variables, falling back to defaults
+func GetIdempotencyConfig() (*IdempotencyConfig, error) {
+	ttl, err := getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	lease, err := getEnvDuration("IDEMPOTENCY_LEASE", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl <= 0 {
+		return nil, fmt.Errorf("IDEMPOTENCY_TTL must be positive")
+	}
+	if lease <= 0 {
+		return nil, fmt.Errorf("IDEMPOTENCY_LEASE must be positive")
+	}
+
+	return &IdempotencyConfig{TTL: ttl, Lease: lease}, nil
+}
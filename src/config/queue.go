@@ -0,0 +1,192 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// QueueConfig holds the settings of the asynchronous push queue
+type QueueConfig struct {
+	Workers      int
+	BatchSize    int
+	PollInterval time.Duration
+	LockTimeout  time.Duration
+
+	// Retry settings for transient provider failures
+	MaxAttempts    int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+
+	// SchedulerInterval is how often due scheduled notifications are dispatched
+	SchedulerInterval time.Duration
+
+	// SchedulerMaxAttempts is how many times dispatching a scheduled notification may fail
+	// before it is marked failed
+	SchedulerMaxAttempts int
+
+	// Fan-out settings for providers that send to many tokens per request (FCM multicast)
+	MulticastSize        int // jobs of one notification a worker claims and sends together
+	MulticastConcurrency int // batch requests in flight per worker
+
+	// PayloadOverflow is what happens to payloads over a provider's size limit: "reject" or "truncate"
+	PayloadOverflow string
+
+	// MaxRequestBytes caps the body of push requests
+	MaxRequestBytes int
+}
+
+// GetQueueConfig reads queue settings from environment variables, falling back to defaults
+func GetQueueConfig() (*QueueConfig, error) {
+	workers, err := getEnvInt("QUEUE_WORKERS", 4)
+	if err != nil {
+		return nil, err
+	}
+
+	batchSize, err := getEnvInt("QUEUE_BATCH_SIZE", 10)
+	if err != nil {
+		return nil, err
+	}
+
+	pollInterval, err := getEnvDuration("QUEUE_POLL_INTERVAL", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	lockTimeout, err := getEnvDuration("QUEUE_LOCK_TIMEOUT", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	maxAttempts, err := getEnvInt("QUEUE_MAX_ATTEMPTS", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	retryBaseDelay, err := getEnvDuration("QUEUE_RETRY_BASE_DELAY", 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	retryMaxDelay, err := getEnvDuration("QUEUE_RETRY_MAX_DELAY", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	schedulerInterval, err := getEnvDuration("SCHEDULER_INTERVAL", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	schedulerMaxAttempts, err := getEnvInt("SCHEDULER_MAX_ATTEMPTS", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	multicastSize, err := getEnvInt("QUEUE_MULTICAST_SIZE", 5000)
+	if err != nil {
+		return nil, err
+	}
+
+	multicastConcurrency, err := getEnvInt("QUEUE_MULTICAST_CONCURRENCY", 4)
+	if err != nil {
+		return nil, err
+	}
+
+	payloadOverflow := os.Getenv("PAYLOAD_OVERFLOW_STRATEGY")
+	if payloadOverflow == "" {
+		payloadOverflow = "reject"
+	}
+	if payloadOverflow != "reject" && payloadOverflow != "truncate" {
+		return nil, fmt.Errorf("PAYLOAD_OVERFLOW_STRATEGY must be reject or truncate")
+	}
+
+	// Job payloads are MEDIUMTEXT (16MB). JSON-encoding can grow a body several times over, as
+	// <, > and & are escaped to 6 bytes each, so the cap stays far below that.
+	maxRequestBytes, err := getEnvInt("PUSH_MAX_REQUEST_BYTES", 32*1024)
+	if err != nil {
+		return nil, err
+	}
+	if maxRequestBytes < 1 || maxRequestBytes > 1<<20 {
+		return nil, fmt.Errorf("PUSH_MAX_REQUEST_BYTES must be between 1 and %d", 1<<20)
+	}
+
+	if workers < 1 || batchSize < 1 || maxAttempts < 1 || schedulerMaxAttempts < 1 {
+		return nil, fmt.Errorf("QUEUE_WORKERS, QUEUE_BATCH_SIZE, QUEUE_MAX_ATTEMPTS and SCHEDULER_MAX_ATTEMPTS must be positive")
+	}
+
+	if multicastSize < 1 || multicastConcurrency < 1 {
+		return nil, fmt.Errorf("QUEUE_MULTICAST_SIZE and QUEUE_MULTICAST_CONCURRENCY must be positive")
+	}
+
+	if retryBaseDelay <= 0 || retryMaxDelay < retryBaseDelay {
+		return nil, fmt.Errorf("QUEUE_RETRY_BASE_DELAY must be positive and not exceed QUEUE_RETRY_MAX_DELAY")
+	}
+
+	if pollInterval <= 0 || lockTimeout <= 0 || schedulerInterval <= 0 {
+		return nil, fmt.Errorf("QUEUE_POLL_INTERVAL, QUEUE_LOCK_TIMEOUT and SCHEDULER_INTERVAL must be positive")
+	}
+
+	return &QueueConfig{
+		Workers:      workers,
+		BatchSize:    batchSize,
+		PollInterval: pollInterval,
+		LockTimeout:  lockTimeout,
+
+		MaxAttempts:    maxAttempts,
+		RetryBaseDelay: retryBaseDelay,
+		RetryMaxDelay:  retryMaxDelay,
+
+		SchedulerInterval:    schedulerInterval,
+		SchedulerMaxAttempts: schedulerMaxAttempts,
+
+		MulticastSize:        multicastSize,
+		MulticastConcurrency: multicastConcurrency,
+
+		PayloadOverflow: payloadOverflow,
+		MaxRequestBytes: maxRequestBytes,
+	}, nil
+}
+
+// getEnvInt reads an integer environment variable, returning def when unset
+func getEnvInt(name string, def int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return parsed, nil
+}
+
+// getEnvDuration reads a duration environment variable (e.g. "500ms", "2m"), returning def when unset
+func getEnvDuration(name string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return parsed, nil
+}
+
+// getEnvBool reads a boolean environment variable (e.g. "true", "0"), returning def when unset
+func getEnvBool(name string, def bool) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// RateLimitConfig holds the settings for per-tenant rate limiting
+type RateLimitConfig struct {
+	// RefreshInterval is how long tenant limits are cached before being reloaded from the database
+	RefreshInterval time.Duration
+}
+
+// GetRateLimitConfig reads rate limit settings from environment variables, falling back to defaults
+func GetRateLimitConfig() (*RateLimitConfig, error) {
+	refresh, err := getEnvDuration("RATE_LIMIT_REFRESH_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	if refresh <= 0 {
+		return nil, fmt.Errorf("RATE_LIMIT_REFRESH_INTERVAL must be positive")
+	}
+
+	return &RateLimitConfig{RefreshInterval: refresh}, nil
+}
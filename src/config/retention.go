@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// RetentionConfig holds how long delivery history is kept. Zero keeps it forever.
+type RetentionConfig struct {
+	// PushJobs is how long sent and failed push jobs are kept after completing
+	PushJobs time.Duration
+
+	// Deliveries is how long sent and failed deliveries are kept after being created
+	Deliveries time.Duration
+}
+
+// GetRetentionConfig reads retention settings from environment variables, falling back to defaults
+func GetRetentionConfig() (*RetentionConfig, error) {
+	pushJobs, err := getEnvDuration("PUSH_JOB_RETENTION", 7*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := getEnvDuration("DELIVERY_RETENTION", 90*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	if pushJobs < 0 || deliveries < 0 {
+		return nil, fmt.Errorf("PUSH_JOB_RETENTION and DELIVERY_RETENTION must not be negative")
+	}
+
+	return &RetentionConfig{PushJobs: pushJobs, Deliveries: deliveries}, nil
+}
@@ -0,0 +1,18 @@
+package config
+
+// WebPushConfig holds the settings of the Web Push provider
+type WebPushConfig struct {
+	// AllowLocalEndpoints accepts subscription endpoints on loopback, private and link-local
+	// addresses, including plain http on loopback. Only for development against a local push service.
+	AllowLocalEndpoints bool
+}
+
+// GetWebPushConfig reads Web Push settings from environment variables, falling back to defaults
+func GetWebPushConfig() (*WebPushConfig, error) {
+	allowLocal, err := getEnvBool("WEBPUSH_ALLOW_LOCAL_ENDPOINTS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebPushConfig{AllowLocalEndpoints: allowLocal}, nil
+}
@@ -141,6 +141,13 @@ func InitCache() error {
 
 // AutoMigrate runs database migrations
 func AutoMigrate() error {
+	if err := dedupeDeviceTokens(); err != nil {
+		return fmt.Errorf("failed to deduplicate device tokens: %w", err)
+	}
+	if err := normalizeDevicePlatforms(); err != nil {
+		return fmt.Errorf("failed to normalize device platforms: %w", err)
+	}
+
 	// Create tables in proper order: parent first, then children
 	return DB.AutoMigrate(
 		&models.Tenant{},
@@ -148,5 +155,74 @@ func AutoMigrate() error {
 		&models.DeviceToken{},
 		&models.APNSConfig{},
 		&models.FCMConfig{},
+		&models.WebPushConfig{},
+		&models.Notification{},
+		&models.Delivery{},
+		&models.PushJob{},
+		&models.DeadLetter{},
+		&models.IdempotencyKey{},
+		&models.TenantUsage{},
+		&models.LiveActivityToken{},
+		&models.TopicSubscription{},
+		&models.DeviceAttribute{},
+		&models.Template{},
+		&models.TemplateVariant{},
+		&models.ErasureAudit{},
 	)
 }
+
+// dedupeDeviceTokens prepares device_tokens for its unique (tenant_id, device_token) index.
+// Registrations used to be keyed by user and platform, so a token could be registered to several
+// users; only the most recent registration of each token is kept.
+func dedupeDeviceTokens() error {
+	migrator := DB.Migrator()
+	if !migrator.HasTable(&models.DeviceToken{}) || migrator.HasIndex(&models.DeviceToken{}, "idx_device_tokens_tenant_token") {
+		return nil
+	}
+
+	var ids []uint
+	err := DB.Table("device_tokens AS older").
+		Distinct("older.id").
+		Joins("JOIN device_tokens AS newer ON newer.tenant_id = older.tenant_id AND newer.device_token = older.device_token AND newer.id > older.id").
+		Pluck("older.id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	// Remove what belonged to the superseded registrations, on databases that already have those tables
+	for _, model := range []interface{}{&models.DeviceAttribute{}, &models.TopicSubscription{}} {
+		if !migrator.HasTable(model) {
+			continue
+		}
+		if err := DB.Where("device_id IN ?", ids).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := DB.Where("id IN ?", ids).Delete(&models.DeviceToken{}).Error; err != nil {
+		return err
+	}
+
+	log.Printf("Removed %d superseded device registration(s) before adding the unique token index", len(ids))
+	return nil
+}
+
+// normalizeDevicePlatforms lowercases the platform of registrations made before platforms were
+// normalized at registration, so e.g. "IOS" devices resolve to the APNS provider
+func normalizeDevicePlatforms() error {
+	if !DB.Migrator().HasTable(&models.DeviceToken{}) {
+		return nil
+	}
+
+	result := DB.Model(&models.DeviceToken{}).
+		Where("BINARY platform <> BINARY LOWER(TRIM(platform))").
+		Update("platform", gorm.Expr("LOWER(TRIM(platform))"))
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		log.Printf("Normalized the platform of %d device registration(s)", result.RowsAffected)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gaulatti/signal/src/middleware"
+	"github.com/gaulatti/signal/src/services"
+	"gorm.io/gorm"
+)
+
+// DeadLettersHandler lists the tenant's failed push jobs that have not been replayed
+func DeadLettersHandler(queue *services.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		tenantID := middleware.GetTenantID(r)
+		if tenantID == "" {
+			http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+			return
+		}
+
+		limit := 100
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > 1000 {
+				http.Error(w, "Invalid limit: must be between 1 and 1000", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		deadLetters, err := queue.ListDeadLetters(tenantID, limit)
+		if err != nil {
+			log.Printf("Error listing dead letters for tenant %s: %v", tenantID, err)
+			http.Error(w, "Failed to list dead letters", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"dead_letters": deadLetters,
+			"count":        len(deadLetters),
+		})
+	}
+}
+
+// DeadLetterReplayHandler requeues a dead-lettered push job
+func DeadLetterReplayHandler(queue *services.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		tenantID := middleware.GetTenantID(r)
+		if tenantID == "" {
+			http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+			return
+		}
+
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid dead letter ID", http.StatusBadRequest)
+			return
+		}
+
+		deadLetter, err := queue.ReplayDeadLetter(tenantID, uint(id))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Dead letter not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, services.ErrAlreadyReplayed) {
+			http.Error(w, "Dead letter already replayed", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Error replaying dead letter %d for tenant %s: %v", id, tenantID, err)
+			http.Error(w, "Failed to replay dead letter", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Dead letter %d replayed for tenant %s: notification=%s", id, tenantID, deadLetter.NotificationID)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":         true,
+			"message":         "Dead letter requeued",
+			"notification_id": deadLetter.NotificationID,
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gaulatti/signal/src/database"
+	"github.com/gaulatti/signal/src/middleware"
+	"github.com/gaulatti/signal/src/models"
+	"github.com/gaulatti/signal/src/services"
+	"gorm.io/gorm"
+)
+
+// DevicesHandler handles GET /devices, listing the tenant's devices a page at a time. Results are
+// ordered by ID; pass the next_cursor of a page as cursor to get the following one.
+func DevicesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r)
+	if tenantID == "" {
+		http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+
+	limit := 50
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			http.Error(w, "Invalid limit: must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	var cursor uint64
+	if value := query.Get("cursor"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		cursor = parsed
+	}
+
+	filter := models.DeviceFilter{UserID: query.Get("user_id")}
+	if value := query.Get("platform"); value != "" {
+		platform, environment, err := services.NormalizePlatform(value)
+		if err != nil {
+			http.Error(w, "Invalid platform: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Platform = platform
+		filter.Environment = environment
+	}
+	if value := query.Get("updated_since"); value != "" {
+		updatedSince, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid updated_since: expected RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		filter.UpdatedSince = &updatedSince
+	}
+
+	// Fetch one extra device to know whether another page follows
+	devices, err := models.ListDevices(database.DB, tenantID, filter, uint(cursor), limit+1)
+	if err != nil {
+		log.Printf("Error listing devices for tenant %s: %v", tenantID, err)
+		http.Error(w, "Failed to list devices", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{}
+	if len(devices) > limit {
+		devices = devices[:limit]
+		response["next_cursor"] = strconv.FormatUint(uint64(devices[limit-1].ID), 10)
+	}
+	response["devices"] = devices
+	response["count"] = len(devices)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeviceHandler handles GET /devices/{id}, returning one of the tenant's devices with its
+// attributes and tags
+func DeviceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r)
+	if tenantID == "" {
+		http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+		return
+	}
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid device id", http.StatusBadRequest)
+		return
+	}
+
+	device, err := models.GetDevice(database.DB, tenantID, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading device %d for tenant %s: %v", id, tenantID, err)
+		http.Error(w, "Failed to load device", http.StatusInternalServerError)
+		return
+	}
+
+	attributes, tags, err := models.GetDeviceAttributes(database.DB, device.ID)
+	if err != nil {
+		log.Printf("Error loading attributes of device %d for tenant %s: %v", device.ID, tenantID, err)
+		http.Error(w, "Failed to load device attributes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device":     device,
+		"attributes": attributes,
+		"tags":       tags,
+	})
+}
+
+// DeviceAttributesRequest replaces the attributes and tags of a device
+type DeviceAttributesRequest struct {
+	Attributes map[string]string `json:"attributes"`
+	Tags       []string          `json:"tags"`
+}
+
+// DeviceAttributesHandler handles PUT /devices/{id}/attributes, replacing every attribute and tag
+// of one of the tenant's devices
+func DeviceAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r)
+	if tenantID == "" {
+		http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+		return
+	}
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid device id", http.StatusBadRequest)
+		return
+	}
+
+	var device models.DeviceToken
+	if err := database.DB.Where("tenant_id = ? AND id = ?", tenantID, id).First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error finding device %d for tenant %s: %v", id, tenantID, err)
+		http.Error(w, "Failed to find device", http.StatusInternalServerError)
+		return
+	}
+
+	var req DeviceAttributesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.ValidateDeviceAttributes(req.Attributes, req.Tags); err != nil {
+		http.Error(w, "Invalid attributes: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := models.SetDeviceAttributes(tx, tenantID, device.ID, req.Attributes); err != nil {
+			return err
+		}
+		return models.SetDeviceTags(tx, tenantID, device.ID, req.Tags)
+	})
+	if err != nil {
+		log.Printf("Error saving attributes of device %d for tenant %s: %v", device.ID, tenantID, err)
+		http.Error(w, "Failed to save device attributes", http.StatusInternalServerError)
+		return
+	}
+
+	attributes, tags, err := models.GetDeviceAttributes(database.DB, device.ID)
+	if err != nil {
+		log.Printf("Error loading attributes of device %d for tenant %s: %v", device.ID, tenantID, err)
+		http.Error(w, "Failed to load device attributes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":         device.ID,
+		"attributes": attributes,
+		"tags":       tags,
+	})
+}
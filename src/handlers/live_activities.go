@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gaulatti/signal/src/database"
+	"github.com/gaulatti/signal/src/middleware"
+	"github.com/gaulatti/signal/src/models"
+	"github.com/gaulatti/signal/src/services"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LiveActivityTokenRequest represents the Live Activity token registration payload
+type LiveActivityTokenRequest struct {
+	PushToken      string `json:"push_token"`
+	TokenType      string `json:"token_type,omitempty"` // "update" (default) or "push_to_start"
+	ActivityID     string `json:"activity_id,omitempty"`
+	AttributesType string `json:"attributes_type,omitempty"`
+	DeviceToken    string `json:"device_token,omitempty"`
+	UserID         string `json:"user_id,omitempty"`
+}
+
+// LiveActivityPushRequest represents a Live Activity start, update or end push
+type LiveActivityPushRequest struct {
+	PushToken string `json:"push_token"`
+	UserID    string `json:"user_id,omitempty"`
+	Title     string `json:"title,omitempty"` // optional alert shown with the update
+	Body      string `json:"body,omitempty"`
+
+	services.LiveActivity
+
+	Priority   int        `json:"priority,omitempty"`   // 5 or 10
+	Expiration *time.Time `json:"expiration,omitempty"` // RFC3339
+	DryRun     bool       `json:"dry_run,omitempty"`    // build and validate without sending or ending the token
+}
+
+// LiveActivityTokenHandler registers the push token of a Live Activity
+func LiveActivityTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r)
+	if tenantID == "" {
+		http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+		return
+	}
+
+	var req LiveActivityTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if req.PushToken == "" {
+		http.Error(w, "Missing required field: push_token", http.StatusBadRequest)
+		return
+	}
+
+	req.DeviceToken = services.CanonicalDeviceToken(req.DeviceToken)
+
+	if req.TokenType == "" {
+		req.TokenType = models.LiveActivityTokenUpdate
+	}
+	if req.TokenType != models.LiveActivityTokenUpdate && req.TokenType != models.LiveActivityTokenPushToStart {
+		http.Error(w, "Invalid token_type: must be update or push_to_start", http.StatusBadRequest)
+		return
+	}
+
+	token := models.LiveActivityToken{
+		TenantID:       tenantID,
+		PushToken:      req.PushToken,
+		TokenType:      req.TokenType,
+		ActivityID:     req.ActivityID,
+		AttributesType: req.AttributesType,
+		DeviceToken:    req.DeviceToken,
+		UserID:         req.UserID,
+		Active:         true,
+	}
+
+	// Registering a token again refreshes it and reactivates it if it had ended
+	if err := database.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "tenant_id"}, {Name: "push_token"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"token_type":      req.TokenType,
+			"activity_id":     req.ActivityID,
+			"attributes_type": req.AttributesType,
+			"device_token":    req.DeviceToken,
+			"user_id":         req.UserID,
+			"active":          true,
+			"ended_at":        nil,
+			"updated_at":      time.Now(),
+		}),
+	}).Create(&token).Error; err != nil {
+		log.Printf("Error saving live activity token for tenant %s: %v", tenantID, err)
+		http.Error(w, "Failed to register live activity token", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Live activity token registered for tenant %s: type=%s, activity=%s", tenantID, req.TokenType, req.ActivityID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Live activity token registered successfully",
+	})
+}
+
+// LiveActivityPushHandler queues a Live Activity start, update or end push to an activity token
+func LiveActivityPushHandler(queue *services.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		tenantID := middleware.GetTenantID(r)
+		if tenantID == "" {
+			http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+			return
+		}
+
+		var req LiveActivityPushRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+
+		if req.PushToken == "" {
+			http.Error(w, "Missing required field: push_token", http.StatusBadRequest)
+			return
+		}
+
+		if err := req.LiveActivity.Validate(); err != nil {
+			http.Error(w, "Invalid live activity: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		options := &services.APNSOptions{Priority: req.Priority, Expiration: req.Expiration}
+		if err := options.Validate(); err != nil {
+			http.Error(w, "Invalid APNS options: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Refuse tokens we know can no longer be used
+		var token models.LiveActivityToken
+		err := database.DB.Where("tenant_id = ? AND push_token = ?", tenantID, req.PushToken).First(&token).Error
+		switch {
+		case err == nil && !token.Active:
+			http.Error(w, "Live activity has ended", http.StatusGone)
+			return
+		case err == nil && (req.Event == services.LiveActivityEventStart) != (token.TokenType == models.LiveActivityTokenPushToStart):
+			http.Error(w, "start events require a push_to_start token, update and end events an update token", http.StatusBadRequest)
+			return
+		case err == nil && req.UserID == "":
+			req.UserID = token.UserID
+		case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+			log.Printf("Error finding live activity token for tenant %s: %v", tenantID, err)
+			http.Error(w, "Failed to find live activity token", http.StatusInternalServerError)
+			return
+		}
+
+		// The timestamp orders updates; stamp it now so retries cannot overtake newer updates
+		if req.Timestamp == 0 {
+			req.Timestamp = time.Now().Unix()
+		}
+
+		target := services.Target{
+			Type:     models.TargetDevice,
+			Value:    req.PushToken,
+			Platform: models.PlatformIOS,
+			UserID:   req.UserID,
+		}
+
+		msg := &services.Message{Title: req.Title, Body: req.Body, APNS: options, LiveActivity: &req.LiveActivity}
+		if !validatePayload(w, queue, tenantID, msg, models.PlatformIOS) {
+			return
+		}
+		// The token is ended by the queue once the end event has been delivered, so a failed end
+		// push can be sent again
+		submitPush(w, queue, tenantID, target, msg, nil, nil, req.DryRun)
+	}
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gaulatti/signal/src/database"
+	"github.com/gaulatti/signal/src/middleware"
+	"github.com/gaulatti/signal/src/models"
+	"github.com/gaulatti/signal/src/services"
+	"gorm.io/gorm"
+)
+
+// NotificationHandler returns a notification with its per-status delivery counts and a page of
+// its deliveries. Deliveries are ordered by ID; pass the next_cursor of a page as cursor to get
+// the following one.
+func NotificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r)
+	if tenantID == "" {
+		http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+
+	limit := 100
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			http.Error(w, "Invalid limit: must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	var cursor uint64
+	if value := query.Get("cursor"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		cursor = parsed
+	}
+
+	filter := models.DeliveryFilter{UserID: query.Get("user_id"), Status: query.Get("status")}
+	switch filter.Status {
+	case "", models.DeliveryStatusPending, models.DeliveryStatusSent, models.DeliveryStatusFailed:
+	default:
+		http.Error(w, "Invalid status: must be pending, sent or failed", http.StatusBadRequest)
+		return
+	}
+
+	notificationID := r.PathValue("id")
+	notification, err := models.GetNotification(database.DB, tenantID, notificationID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading notification %s for tenant %s: %v", notificationID, tenantID, err)
+		http.Error(w, "Failed to load notification", http.StatusInternalServerError)
+		return
+	}
+
+	counts, err := models.CountDeliveriesByStatus(database.DB, tenantID, notificationID)
+	if err != nil {
+		log.Printf("Error counting deliveries of notification %s for tenant %s: %v", notificationID, tenantID, err)
+		http.Error(w, "Failed to load notification", http.StatusInternalServerError)
+		return
+	}
+
+	// Fetch one extra delivery to know whether another page follows
+	deliveries, err := models.ListDeliveries(database.DB, tenantID, notificationID, filter, uint(cursor), limit+1)
+	if err != nil {
+		log.Printf("Error listing deliveries of notification %s for tenant %s: %v", notificationID, tenantID, err)
+		http.Error(w, "Failed to load notification", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"notification": notification,
+		"counts":       counts,
+	}
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+		response["next_cursor"] = strconv.FormatUint(uint64(deliveries[limit-1].ID), 10)
+	}
+	response["deliveries"] = deliveries
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// NotificationsHandler lists recent notifications, optionally only those sent to a user
+func NotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r)
+	if tenantID == "" {
+		http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+		return
+	}
+
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			http.Error(w, "Invalid limit: must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	userID := r.URL.Query().Get("user_id")
+	notifications, err := models.ListNotifications(database.DB, tenantID, userID, limit)
+	if err != nil {
+		log.Printf("Error listing notifications for tenant %s: %v", tenantID, err)
+		http.Error(w, "Failed to list notifications", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": notifications,
+		"count":         len(notifications),
+	})
+}
+
+// ScheduledNotificationsHandler lists the tenant's pending scheduled notifications
+func ScheduledNotificationsHandler(queue *services.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		tenantID := middleware.GetTenantID(r)
+		if tenantID == "" {
+			http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+			return
+		}
+
+		limit := 100
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > 1000 {
+				http.Error(w, "Invalid limit: must be between 1 and 1000", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		notifications, err := queue.ListScheduled(tenantID, limit)
+		if err != nil {
+			log.Printf("Error listing scheduled notifications for tenant %s: %v", tenantID, err)
+			http.Error(w, "Failed to list scheduled notifications", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"notifications": notifications,
+			"count":         len(notifications),
+		})
+	}
+}
+
+// CancelNotificationHandler cancels a scheduled notification before it is sent
+func CancelNotificationHandler(queue *services.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		tenantID := middleware.GetTenantID(r)
+		if tenantID == "" {
+			http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+			return
+		}
+
+		notificationID := r.PathValue("id")
+		err := queue.CancelScheduled(tenantID, notificationID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Notification not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, services.ErrNotCancellable) {
+			http.Error(w, "Notification is no longer scheduled", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Error cancelling notification %s for tenant %s: %v", notificationID, tenantID, err)
+			http.Error(w, "Failed to cancel notification", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Scheduled notification %s cancelled for tenant %s", notificationID, tenantID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":         true,
+			"message":         "Scheduled notification cancelled",
+			"notification_id": notificationID,
+		})
+	}
+}
@@ -2,55 +2,246 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gaulatti/signal/src/database"
 	"github.com/gaulatti/signal/src/middleware"
 	"github.com/gaulatti/signal/src/models"
+	"github.com/gaulatti/signal/src/services"
 )
 
 // PushRequest represents the push notification payload
 type PushRequest struct {
-	UserID string                 `json:"user_id,omitempty"`
-	Title  string                 `json:"title"`
-	Body   string                 `json:"body"`
-	Data   map[string]interface{} `json:"data,omitempty"`
+	UserID   string                   `json:"user_id,omitempty"`
+	Segment  string                   `json:"segment,omitempty"` // e.g. "tag:beta AND locale:es*"
+	Title    string                   `json:"title"`
+	Body     string                   `json:"body"`
+	Data     map[string]interface{}   `json:"data,omitempty"`
+	Template string                   `json:"template_id,omitempty"` // renders title and body per device locale
+	Vars     map[string]interface{}   `json:"variables,omitempty"`
+	SendAt   string                   `json:"send_at,omitempty"` // RFC3339; omit to send immediately
+	Delivery *services.DeliveryWindow `json:"delivery,omitempty"`
+	APNS     *services.APNSOptions    `json:"apns,omitempty"`    // applied to iOS devices only
+	FCM      *services.FCMOptions     `json:"fcm,omitempty"`     // applied to Android devices only
+	WebPush  *services.WebPushOptions `json:"webpush,omitempty"` // applied to web devices only
+	DryRun   bool                     `json:"dry_run,omitempty"` // build and validate without sending
 }
 
-// PushHandler handles push notification requests
-func PushHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// PushHandler handles push notification requests, queueing a delivery for every matching device
+func PushHandler(queue *services.Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		tenantID := middleware.GetTenantID(r)
+		if tenantID == "" {
+			http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+			return
+		}
+
+		var req PushRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+
+		var template *services.TemplateRef
+		if req.Template != "" {
+			template = &services.TemplateRef{ID: req.Template, Variables: req.Vars}
+		} else if req.Title == "" || req.Body == "" {
+			http.Error(w, "Missing required fields: title, body (or template_id)", http.StatusBadRequest)
+			return
+		}
+
+		sendAt, err := parseSendAt(req.SendAt)
+		if err != nil {
+			http.Error(w, "Invalid send_at: expected RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+
+		if req.Delivery != nil {
+			if err := req.Delivery.Validate(); err != nil {
+				http.Error(w, "Invalid delivery: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if req.APNS != nil {
+			if err := req.APNS.Validate(); err != nil {
+				http.Error(w, "Invalid APNS options: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if req.FCM != nil {
+			if err := req.FCM.Validate(); err != nil {
+				http.Error(w, "Invalid FCM options: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if req.WebPush != nil {
+			if err := req.WebPush.Validate(); err != nil {
+				http.Error(w, "Invalid Web Push options: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		target := services.Target{Type: models.TargetTenant}
+		switch {
+		case req.Segment != "":
+			if _, err := services.ParseSegment(req.Segment); err != nil {
+				http.Error(w, "Invalid segment: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			target = services.Target{Type: models.TargetSegment, Value: req.Segment, UserID: req.UserID}
+		case req.UserID != "":
+			target = services.Target{Type: models.TargetUser, Value: req.UserID}
+		}
+
+		msg := &services.Message{Title: req.Title, Body: req.Body, Data: req.Data, APNS: req.APNS, FCM: req.FCM, WebPush: req.WebPush, Template: template}
+		if !validatePayload(w, queue, tenantID, msg) {
+			return
+		}
+		submitPush(w, queue, tenantID, target, msg, req.Delivery, sendAt, req.DryRun)
 	}
+}
 
-	tenantID := middleware.GetTenantID(r)
-	if tenantID == "" {
-		http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
-		return
+// parseSendAt parses an optional RFC3339 send_at value. It returns nil when the value is
+// empty or not in the future, meaning the push is sent immediately.
+func parseSendAt(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
 	}
 
-	var req PushRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
-		return
+	sendAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
 	}
 
-	if req.Title == "" || req.Body == "" {
-		http.Error(w, "Missing required fields: title, body", http.StatusBadRequest)
+	if !sendAt.After(time.Now()) {
+		return nil, nil
+	}
+	return &sendAt, nil
+}
+
+// writeDecodeError answers a push request body that could not be decoded: 413 when it was cut
+// off by the body size limit, otherwise 400
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		middleware.WriteBodyTooLarge(w, maxBytesErr.Limit)
 		return
 	}
+	http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+}
+
+// validatePayload runs queue.ValidatePayload for a push, writing a 404 for an unknown template,
+// a 400 for one that does not render, or a 413 for a payload over a provider limit, and
+// returning false when the push was rejected
+func validatePayload(w http.ResponseWriter, queue *services.Queue, tenantID string, msg *services.Message, platforms ...string) bool {
+	err := queue.ValidatePayload(tenantID, msg, platforms...)
+	if err == nil {
+		return true
+	}
+
+	var templateErr *services.TemplateError
+	var sizeErr *services.PayloadTooLargeError
+	switch {
+	case errors.Is(err, services.ErrTemplateNotFound):
+		http.Error(w, "Template not found: "+msg.Template.ID, http.StatusNotFound)
+	case errors.As(err, &templateErr):
+		http.Error(w, "Invalid template variables: "+templateErr.Err.Error(), http.StatusBadRequest)
+	case errors.As(err, &sizeErr):
+		http.Error(w, "Payload too large: "+sizeErr.Error(), http.StatusRequestEntityTooLarge)
+	default:
+		log.Printf("Error validating payload for tenant %s: %v", tenantID, err)
+		http.Error(w, "Failed to validate payload", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// submitPush schedules the push when sendAt is set, otherwise resolves the target devices and
+// queues a delivery for each, then writes the 202 response. A dry run resolves the devices and
+// writes the provider requests instead of queueing anything. It returns the notification, or
+// nil when none was created.
+func submitPush(w http.ResponseWriter, queue *services.Queue, tenantID string, target services.Target, msg *services.Message, window *services.DeliveryWindow, sendAt *time.Time, dryRun bool) *models.Notification {
+	if dryRun {
+		writeDryRun(w, queue, tenantID, target, msg)
+		return nil
+	}
+
+	if sendAt != nil {
+		notification, err := queue.Schedule(tenantID, target, msg, window, *sendAt)
+		if err != nil {
+			log.Printf("Error scheduling push for tenant %s: %v", tenantID, err)
+			http.Error(w, "Failed to schedule push notification", http.StatusInternalServerError)
+			return nil
+		}
+
+		log.Printf("Push scheduled for tenant %s: notification=%s, target=%s:%s, send_at=%s",
+			tenantID, notification.ID, target.Type, target.Value, sendAt.Format(time.RFC3339))
+
+		writeNotificationAccepted(w, tenantID, notification, "Push notification scheduled", nil)
+		return notification
+	}
 
-	// Find target devices
-	var devices []models.DeviceToken
-	query := database.DB.Where("tenant_id = ?", tenantID)
+	devices, err := services.ResolveDevices(database.DB, tenantID, target)
+	if err != nil {
+		log.Printf("Error finding devices: %v", err)
+		http.Error(w, "Failed to find target devices", http.StatusInternalServerError)
+		return nil
+	}
+
+	if len(devices) == 0 {
+		http.Error(w, "No devices found for push notification", http.StatusNotFound)
+		return nil
+	}
 
-	if req.UserID != "" {
-		query = query.Where("user_id = ?", req.UserID)
+	notification, err := queue.Enqueue(tenantID, target, devices, msg, window)
+	var quotaErr *services.QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		writeQuotaExceeded(w, quotaErr)
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error queueing push for tenant %s: %v", tenantID, err)
+		http.Error(w, "Failed to queue push notification", http.StatusInternalServerError)
+		return nil
 	}
 
-	if err := query.Find(&devices).Error; err != nil {
+	log.Printf("Push queued for tenant %s: notification=%s, target=%s:%s, devices=%d",
+		tenantID, notification.ID, target.Type, target.Value, len(devices))
+
+	writeNotificationAccepted(w, tenantID, notification, "Push notification queued", map[string]interface{}{
+		"devices_queued": len(devices),
+	})
+	return notification
+}
+
+// writeQuotaExceeded answers 429 for a push that would exceed the tenant's quota, with the same
+// headers as the Quota middleware
+func writeQuotaExceeded(w http.ResponseWriter, err *services.QuotaExceededError) {
+	retryAfter := int(math.Ceil(time.Until(err.ResetsAt).Seconds()))
+	w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(err.Limit, 10))
+	w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(err.Remaining, 10))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(retryAfter))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+}
+
+// writeDryRun resolves the target devices and responds with the requests each provider would
+// send, without recording a notification or notifying any device
+func writeDryRun(w http.ResponseWriter, queue *services.Queue, tenantID string, target services.Target, msg *services.Message) {
+	devices, err := services.ResolveDevices(database.DB, tenantID, target)
+	if err != nil {
 		log.Printf("Error finding devices: %v", err)
 		http.Error(w, "Failed to find target devices", http.StatusInternalServerError)
 		return
@@ -61,16 +252,57 @@ func PushHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Simulate push notification (just log for now)
-	for _, device := range devices {
-		log.Printf("📱 [SIMULATED PUSH] Tenant: %s, User: %s, Platform: %s, Device: %s, Title: %s, Body: %s, Data: %+v",
-			tenantID, device.UserID, device.Platform, device.DeviceToken, req.Title, req.Body, req.Data)
+	results, err := queue.DryRun(tenantID, devices, msg)
+	var templateErr *services.TemplateError
+	if errors.As(err, &templateErr) {
+		http.Error(w, "Invalid template: "+templateErr.Err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error running dry run for tenant %s: %v", tenantID, err)
+		http.Error(w, "Failed to run dry run", http.StatusInternalServerError)
+		return
 	}
 
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+
+	log.Printf("Dry run for tenant %s: target=%s:%s, devices=%d, previewed=%d, failed=%d",
+		tenantID, target.Type, target.Value, len(devices), len(results), failed)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":      true,
-		"message":      "Push notification sent",
-		"devices_sent": len(devices),
+		"success":         failed == 0,
+		"dry_run":         true,
+		"tenant":          tenantID,
+		"devices_matched": len(devices),
+		"devices_failed":  failed,
+		"results":         results,
 	})
 }
+
+// writeNotificationAccepted responds with 202 Accepted and the ID used to query the notification
+func writeNotificationAccepted(w http.ResponseWriter, tenantID string, notification *models.Notification, message string, extra map[string]interface{}) {
+	response := map[string]interface{}{
+		"success":         true,
+		"message":         message,
+		"notification_id": notification.ID,
+		"status":          notification.Status,
+		"tenant":          tenantID,
+	}
+	if notification.SendAt != nil {
+		response["send_at"] = notification.SendAt.Format(time.RFC3339)
+	}
+	for key, value := range extra {
+		response[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/notifications/"+notification.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
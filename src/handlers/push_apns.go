@@ -2,24 +2,31 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 
 	"github.com/gaulatti/signal/src/middleware"
+	"github.com/gaulatti/signal/src/models"
 	"github.com/gaulatti/signal/src/services"
 )
 
 // APNSPushRequest represents the APNS push notification payload
 type APNSPushRequest struct {
-	UserID      string                 `json:"user_id"`
-	DeviceToken string                 `json:"device_token"`
-	Title       string                 `json:"title"`
-	Body        string                 `json:"body"`
-	Data        map[string]interface{} `json:"data,omitempty"`
+	UserID      string                   `json:"user_id"`
+	DeviceToken string                   `json:"device_token"`
+	Title       string                   `json:"title"`
+	Body        string                   `json:"body"`
+	Data        map[string]interface{}   `json:"data,omitempty"`
+	SendAt      string                   `json:"send_at,omitempty"` // RFC3339; omit to send immediately
+	Delivery    *services.DeliveryWindow `json:"delivery,omitempty"`
+	DryRun      bool                     `json:"dry_run,omitempty"` // build and validate without sending
+
+	// badge, sound, category, thread_id, subtitle, mutable_content, content_available and
+	// the push_type, priority, expiration and collapse_id headers
+	services.APNSOptions
 }
 
 // APNSPushHandler handles APNS push notification requests
-func APNSPushHandler(apnsService *services.APNSService) http.HandlerFunc {
+func APNSPushHandler(queue *services.Queue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -34,29 +41,62 @@ func APNSPushHandler(apnsService *services.APNSService) http.HandlerFunc {
 
 		var req APNSPushRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			writeDecodeError(w, err)
+			return
+		}
+
+		if req.DeviceToken == "" {
+			http.Error(w, "Missing required field: device_token", http.StatusBadRequest)
+			return
+		}
+
+		token, err := services.NormalizeDeviceToken(models.PlatformIOS, req.DeviceToken)
+		if err != nil {
+			http.Error(w, "Invalid device_token: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.DeviceToken = token
+
+		// Silent background pushes (content_available) may omit the alert
+		if !req.ContentAvailable && (req.Title == "" || req.Body == "") {
+			http.Error(w, "Missing required fields: title, body", http.StatusBadRequest)
 			return
 		}
 
-		if req.DeviceToken == "" || req.Title == "" || req.Body == "" {
-			http.Error(w, "Missing required fields: device_token, title, body", http.StatusBadRequest)
+		if err := req.APNSOptions.Validate(); err != nil {
+			http.Error(w, "Invalid APNS options: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		// Send APNS push notification
-		if err := apnsService.SendPush(tenantID, req.DeviceToken, req.Title, req.Body, req.Data); err != nil {
-			log.Printf("Error sending APNS push for tenant %s: %v", tenantID, err)
-			http.Error(w, "Failed to send push notification", http.StatusInternalServerError)
+		if _, exists := req.Data["aps"]; exists {
+			http.Error(w, "data must not contain the reserved key aps", http.StatusBadRequest)
 			return
 		}
 
-		log.Printf("APNS push sent for tenant %s: user=%s, device=%s", tenantID, req.UserID, req.DeviceToken)
+		sendAt, err := parseSendAt(req.SendAt)
+		if err != nil {
+			http.Error(w, "Invalid send_at: expected RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+
+		if req.Delivery != nil {
+			if err := req.Delivery.Validate(); err != nil {
+				http.Error(w, "Invalid delivery: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": true,
-			"message": "APNS push notification sent successfully",
-			"tenant":  tenantID,
-		})
+		target := services.Target{
+			Type:     models.TargetDevice,
+			Value:    req.DeviceToken,
+			Platform: models.PlatformIOS,
+			UserID:   req.UserID,
+		}
+
+		msg := &services.Message{Title: req.Title, Body: req.Body, Data: req.Data, APNS: &req.APNSOptions}
+		if !validatePayload(w, queue, tenantID, msg, models.PlatformIOS) {
+			return
+		}
+		submitPush(w, queue, tenantID, target, msg, req.Delivery, sendAt, req.DryRun)
 	}
 }
@@ -2,24 +2,36 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
 
 	"github.com/gaulatti/signal/src/middleware"
+	"github.com/gaulatti/signal/src/models"
 	"github.com/gaulatti/signal/src/services"
 )
 
+// maxConditionLen bounds FCM topic conditions so they fit the notification target column
+const maxConditionLen = 500
+
 // FCMPushRequest represents the FCM push notification payload
 type FCMPushRequest struct {
-	UserID      string                 `json:"user_id"`
-	DeviceToken string                 `json:"device_token"`
-	Title       string                 `json:"title"`
-	Body        string                 `json:"body"`
-	Data        map[string]interface{} `json:"data,omitempty"`
+	UserID      string                   `json:"user_id"`
+	DeviceToken string                   `json:"device_token"`
+	Topic       string                   `json:"topic,omitempty"`     // send to topic subscribers instead of a device
+	Condition   string                   `json:"condition,omitempty"` // e.g. "'news' in topics && 'sports' in topics"
+	Title       string                   `json:"title"`
+	Body        string                   `json:"body"`
+	Data        map[string]interface{}   `json:"data,omitempty"`
+	SendAt      string                   `json:"send_at,omitempty"` // RFC3339; omit to send immediately
+	Delivery    *services.DeliveryWindow `json:"delivery,omitempty"`
+	DryRun      bool                     `json:"dry_run,omitempty"` // build and validate without sending
+
+	// data_only, priority, ttl, channel_id, tag, collapse_key, image, click_action, sound and webpush
+	services.FCMOptions
 }
 
 // FCMPushHandler handles FCM push notification requests
-func FCMPushHandler(fcmService *services.FCMService) http.HandlerFunc {
+func FCMPushHandler(queue *services.Queue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -34,29 +46,101 @@ func FCMPushHandler(fcmService *services.FCMService) http.HandlerFunc {
 
 		var req FCMPushRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			writeDecodeError(w, err)
+			return
+		}
+
+		recipients := 0
+		for _, value := range []string{req.DeviceToken, req.Topic, req.Condition} {
+			if value != "" {
+				recipients++
+			}
+		}
+		if recipients != 1 {
+			http.Error(w, "Exactly one of device_token, topic or condition is required", http.StatusBadRequest)
+			return
+		}
+
+		if req.DeviceToken != "" {
+			token, err := services.NormalizeDeviceToken(models.PlatformAndroid, req.DeviceToken)
+			if err != nil {
+				http.Error(w, "Invalid device_token: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.DeviceToken = token
+		}
+
+		if req.Topic != "" {
+			topic, err := services.NormalizeTopic(req.Topic)
+			if err != nil {
+				http.Error(w, "Invalid topic: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.Topic = topic
+		}
+
+		if len(req.Condition) > maxConditionLen {
+			http.Error(w, fmt.Sprintf("condition must be at most %d characters", maxConditionLen), http.StatusBadRequest)
+			return
+		}
+
+		// Data-only messages carry no notification block
+		if req.DataOnly && len(req.Data) == 0 {
+			http.Error(w, "data_only messages require data", http.StatusBadRequest)
+			return
+		}
+		if !req.DataOnly && (req.Title == "" || req.Body == "") {
+			http.Error(w, "Missing required fields: title, body", http.StatusBadRequest)
+			return
+		}
+
+		if err := req.FCMOptions.Validate(); err != nil {
+			http.Error(w, "Invalid FCM options: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		if req.DeviceToken == "" || req.Title == "" || req.Body == "" {
-			http.Error(w, "Missing required fields: device_token, title, body", http.StatusBadRequest)
+		if err := services.ValidateFCMData(req.Data); err != nil {
+			http.Error(w, "Invalid data: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		// Send FCM push notification
-		if err := fcmService.SendPush(tenantID, req.DeviceToken, req.Title, req.Body, req.Data); err != nil {
-			log.Printf("Error sending FCM push for tenant %s: %v", tenantID, err)
-			http.Error(w, "Failed to send push notification", http.StatusInternalServerError)
+		sendAt, err := parseSendAt(req.SendAt)
+		if err != nil {
+			http.Error(w, "Invalid send_at: expected RFC3339 timestamp", http.StatusBadRequest)
 			return
 		}
 
-		log.Printf("FCM push sent for tenant %s: user=%s, device=%s", tenantID, req.UserID, req.DeviceToken)
+		if req.Delivery != nil {
+			if err := req.Delivery.Validate(); err != nil {
+				http.Error(w, "Invalid delivery: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		target := services.Target{
+			Type:     models.TargetDevice,
+			Value:    req.DeviceToken,
+			Platform: models.PlatformAndroid,
+			UserID:   req.UserID,
+		}
+		switch {
+		case req.Topic != "":
+			target = services.Target{Type: models.TargetTopic, Value: req.Topic, UserID: req.UserID}
+		case req.Condition != "":
+			target = services.Target{Type: models.TargetCondition, Value: req.Condition, UserID: req.UserID}
+		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": true,
-			"message": "FCM push notification sent successfully",
-			"tenant":  tenantID,
-		})
+		msg := &services.Message{
+			Title:     req.Title,
+			Body:      req.Body,
+			Data:      req.Data,
+			FCM:       &req.FCMOptions,
+			Topic:     req.Topic,
+			Condition: req.Condition,
+		}
+		if !validatePayload(w, queue, tenantID, msg, models.PlatformAndroid) {
+			return
+		}
+		submitPush(w, queue, tenantID, target, msg, req.Delivery, sendAt, req.DryRun)
 	}
 }
@@ -4,32 +4,61 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gaulatti/signal/src/database"
 	"github.com/gaulatti/signal/src/middleware"
 	"github.com/gaulatti/signal/src/models"
+	"github.com/gaulatti/signal/src/services"
 )
 
 // RegisterRequest represents the device registration payload
 type RegisterRequest struct {
-	DeviceToken string `json:"device_token"`
-	UserID      string `json:"user_id"`
-	Platform    string `json:"platform"`
+	DeviceToken    string `json:"device_token"`
+	InstallationID string `json:"installation_id,omitempty"` // stable per app install; defaults to identifying the device by token
+	UserID         string `json:"user_id"`
+	Platform       string `json:"platform"`
+	Timezone       string `json:"timezone,omitempty"` // IANA name, e.g. "America/New_York"
+	Locale         string `json:"locale,omitempty"`   // BCP 47, e.g. "es-MX"; selects template variants
+
+	// Subscription is the browser PushSubscription of a web registration; its endpoint is the device token
+	Subscription *services.WebPushSubscription `json:"subscription,omitempty"`
+
+	// Attributes and tags replace the stored ones when present; omit them to keep the current values
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Tags       []string          `json:"tags,omitempty"`
 }
 
-// RegisterHandler handles device token registration
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// UnregisterRequest identifies the device to unregister by its token, its installation ID, or both
+type UnregisterRequest struct {
+	DeviceToken    string `json:"device_token,omitempty"`
+	InstallationID string `json:"installation_id,omitempty"`
+}
 
-	tenantID := middleware.GetTenantID(r)
-	if tenantID == "" {
-		http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
-		return
+// RegisterHandler handles POST /register, registering a device, and DELETE /register,
+// unregistering one
+func RegisterHandler(topics *services.TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := middleware.GetTenantID(r)
+		if tenantID == "" {
+			http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			registerDevice(w, r, topics, tenantID)
+		case http.MethodDelete:
+			unregisterDevice(w, r, topics, tenantID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
 	}
+}
 
+// registerDevice creates or updates a device registration. When an Android registration gets a
+// new token, its recorded FCM topic subscriptions are moved to the new token.
+func registerDevice(w http.ResponseWriter, r *http.Request, topics *services.TopicManager, tenantID string) {
 	// Verify tenant exists and is active
 	tenant, err := models.GetTenantByID(database.DB, tenantID)
 	if err != nil {
@@ -49,30 +78,108 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	environment := ""
+	if req.Platform != "" {
+		platform, hint, err := services.NormalizePlatform(req.Platform)
+		if err != nil {
+			http.Error(w, "Invalid platform: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Platform = platform
+		environment = hint
+	}
+
+	if req.Platform == models.PlatformWeb {
+		if req.Subscription == nil {
+			http.Error(w, "Missing required field for web platform: subscription", http.StatusBadRequest)
+			return
+		}
+		if err := req.Subscription.Validate(); err != nil {
+			http.Error(w, "Invalid subscription: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.DeviceToken = req.Subscription.Endpoint
+	}
+
 	if req.DeviceToken == "" || req.UserID == "" || req.Platform == "" {
 		http.Error(w, "Missing required fields: device_token, user_id, platform", http.StatusBadRequest)
 		return
 	}
 
+	token, err := services.NormalizeDeviceToken(req.Platform, req.DeviceToken)
+	if err != nil {
+		http.Error(w, "Invalid device_token: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.DeviceToken = token
+
+	if err := services.ValidateDeviceAttributes(req.Attributes, req.Tags); err != nil {
+		http.Error(w, "Invalid attributes: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			http.Error(w, "Invalid timezone: expected an IANA name such as Europe/Madrid", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.Locale != "" {
+		locale, err := services.NormalizeLocale(req.Locale)
+		if err != nil {
+			http.Error(w, "Invalid locale: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Locale = locale
+	}
+
 	// Create or update device token
 	deviceToken := models.DeviceToken{
-		TenantID:    tenantID,
-		DeviceToken: req.DeviceToken,
-		UserID:      req.UserID,
-		Platform:    req.Platform,
+		TenantID:       tenantID,
+		DeviceToken:    req.DeviceToken,
+		InstallationID: req.InstallationID,
+		UserID:         req.UserID,
+		Platform:       req.Platform,
+		Timezone:       req.Timezone,
+		Locale:         req.Locale,
+		Environment:    environment,
+	}
+	if req.Subscription != nil && req.Platform == models.PlatformWeb {
+		deviceToken.WebPushP256DH = req.Subscription.Keys.P256DH
+		deviceToken.WebPushAuth = req.Subscription.Keys.Auth
 	}
 
-	// Use GORM's upsert functionality
-	result := database.DB.Where("tenant_id = ? AND user_id = ? AND platform = ?",
-		tenantID, req.UserID, req.Platform).Assign(deviceToken).FirstOrCreate(&deviceToken)
-
-	if result.Error != nil {
-		log.Printf("Error saving device token: %v", result.Error)
+	previousToken, err := models.RegisterDevice(database.DB, &deviceToken)
+	if err != nil {
+		log.Printf("Error saving device token: %v", err)
 		http.Error(w, "Failed to register device", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Device registered for tenant %s: user=%s, platform=%s", tenantID, req.UserID, req.Platform)
+	if req.Attributes != nil {
+		if err := models.SetDeviceAttributes(database.DB, tenantID, deviceToken.ID, req.Attributes); err != nil {
+			log.Printf("Error saving device attributes: %v", err)
+			http.Error(w, "Failed to save device attributes", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.Tags != nil {
+		if err := models.SetDeviceTags(database.DB, tenantID, deviceToken.ID, req.Tags); err != nil {
+			log.Printf("Error saving device tags: %v", err)
+			http.Error(w, "Failed to save device tags", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if deviceToken.Platform == models.PlatformAndroid && previousToken != "" && previousToken != deviceToken.DeviceToken {
+		if err := topics.Resubscribe(tenantID, &deviceToken); err != nil {
+			log.Printf("Error resubscribing device %d to topics for tenant %s: %v", deviceToken.ID, tenantID, err)
+		}
+	}
+
+	log.Printf("Device %d registered for tenant %s: user=%s, platform=%s", deviceToken.ID, tenantID, req.UserID, req.Platform)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -82,3 +189,55 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		"tenant":  tenant.Name,
 	})
 }
+
+// unregisterDevice deletes the registrations holding a token or belonging to an installation, e.g.
+// when a user logs out. Android devices are first unsubscribed from their recorded FCM topics.
+func unregisterDevice(w http.ResponseWriter, r *http.Request, topics *services.TopicManager, tenantID string) {
+	var req UnregisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if req.DeviceToken == "" && req.InstallationID == "" {
+		http.Error(w, "Missing required field: device_token or installation_id", http.StatusBadRequest)
+		return
+	}
+	req.DeviceToken = services.CanonicalDeviceToken(req.DeviceToken)
+
+	devices, err := models.FindDevices(database.DB, tenantID, req.DeviceToken, req.InstallationID)
+	if err != nil {
+		log.Printf("Error finding devices to unregister for tenant %s: %v", tenantID, err)
+		http.Error(w, "Failed to unregister device", http.StatusInternalServerError)
+		return
+	}
+	if len(devices) == 0 {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	ids := make([]uint, len(devices))
+	for i := range devices {
+		ids[i] = devices[i].ID
+		if devices[i].Platform == models.PlatformAndroid {
+			if err := topics.UnsubscribeDevice(tenantID, &devices[i]); err != nil {
+				log.Printf("Error unsubscribing device %d from topics for tenant %s: %v", devices[i].ID, tenantID, err)
+			}
+		}
+	}
+
+	if err := models.DeleteDevices(database.DB, tenantID, ids); err != nil {
+		log.Printf("Error unregistering devices for tenant %s: %v", tenantID, err)
+		http.Error(w, "Failed to unregister device", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Unregistered %d device(s) for tenant %s: ids=%v", len(ids), tenantID, ids)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Device unregistered successfully",
+		"deleted": len(ids),
+	})
+}
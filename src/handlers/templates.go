@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gaulatti/signal/src/database"
+	"github.com/gaulatti/signal/src/middleware"
+	"github.com/gaulatti/signal/src/models"
+	"github.com/gaulatti/signal/src/services"
+	"gorm.io/gorm"
+)
+
+// TemplateRequest creates or replaces a notification template
+type TemplateRequest struct {
+	DefaultLocale string                   `json:"default_locale"`
+	Variants      []models.TemplateVariant `json:"variants"`
+}
+
+// TemplatesHandler handles GET /templates, listing the tenant's templates
+func TemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r)
+	if tenantID == "" {
+		http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+		return
+	}
+
+	templates, err := models.ListTemplates(database.DB, tenantID)
+	if err != nil {
+		log.Printf("Error listing templates for tenant %s: %v", tenantID, err)
+		http.Error(w, "Failed to list templates", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"templates": templates,
+		"count":     len(templates),
+	})
+}
+
+// TemplateHandler handles GET, PUT and DELETE /templates/{template_id}
+func TemplateHandler(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r)
+	if tenantID == "" {
+		http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+		return
+	}
+
+	templateID := r.PathValue("template_id")
+
+	switch r.Method {
+	case http.MethodGet:
+		template, err := models.GetTemplate(database.DB, tenantID, templateID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error loading template %s for tenant %s: %v", templateID, tenantID, err)
+			http.Error(w, "Failed to load template", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(template)
+
+	case http.MethodPut:
+		var req TemplateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+
+		template := &models.Template{
+			TenantID:      tenantID,
+			TemplateID:    templateID,
+			DefaultLocale: req.DefaultLocale,
+			Variants:      req.Variants,
+		}
+		if err := services.ValidateTemplate(template); err != nil {
+			http.Error(w, "Invalid template: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := models.SaveTemplate(database.DB, template); err != nil {
+			log.Printf("Error saving template %s for tenant %s: %v", templateID, tenantID, err)
+			http.Error(w, "Failed to save template", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Template %s saved for tenant %s (variants: %d)", templateID, tenantID, len(template.Variants))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(template)
+
+	case http.MethodDelete:
+		deleted, err := models.DeleteTemplate(database.DB, tenantID, templateID)
+		if err != nil {
+			log.Printf("Error deleting template %s for tenant %s: %v", templateID, tenantID, err)
+			http.Error(w, "Failed to delete template", http.StatusInternalServerError)
+			return
+		}
+		if deleted == 0 {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		}
+
+		log.Printf("Template %s deleted for tenant %s", templateID, tenantID)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
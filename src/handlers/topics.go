@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gaulatti/signal/src/middleware"
+	"github.com/gaulatti/signal/src/models"
+	"github.com/gaulatti/signal/src/services"
+)
+
+// maxTopicTokens is the largest number of tokens accepted per subscription request
+const maxTopicTokens = 1000
+
+// TopicSubscriptionRequest represents a topic subscribe or unsubscribe payload
+type TopicSubscriptionRequest struct {
+	DeviceTokens []string `json:"device_tokens"`
+}
+
+// TopicSubscribeHandler subscribes registered Android devices to an FCM topic
+func TopicSubscribeHandler(topics *services.TopicManager) http.HandlerFunc {
+	return topicSubscriptionHandler(topics, true)
+}
+
+// TopicUnsubscribeHandler unsubscribes registered Android devices from an FCM topic
+func TopicUnsubscribeHandler(topics *services.TopicManager) http.HandlerFunc {
+	return topicSubscriptionHandler(topics, false)
+}
+
+// topicSubscriptionHandler handles POST /topics/{topic}/subscribe and /topics/{topic}/unsubscribe
+func topicSubscriptionHandler(topics *services.TopicManager, subscribe bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		tenantID := middleware.GetTenantID(r)
+		if tenantID == "" {
+			http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+			return
+		}
+
+		topic, err := services.NormalizeTopic(r.PathValue("topic"))
+		if err != nil {
+			http.Error(w, "Invalid topic: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var req TopicSubscriptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+
+		if len(req.DeviceTokens) == 0 || len(req.DeviceTokens) > maxTopicTokens {
+			http.Error(w, fmt.Sprintf("device_tokens must contain between 1 and %d tokens", maxTopicTokens), http.StatusBadRequest)
+			return
+		}
+
+		for i, token := range req.DeviceTokens {
+			normalized, err := services.NormalizeDeviceToken(models.PlatformAndroid, token)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid device_tokens[%d]: %v", i, err), http.StatusBadRequest)
+				return
+			}
+			req.DeviceTokens[i] = normalized
+		}
+
+		var result *services.TopicResult
+		if subscribe {
+			result, err = topics.Subscribe(tenantID, topic, req.DeviceTokens)
+		} else {
+			result, err = topics.Unsubscribe(tenantID, topic, req.DeviceTokens)
+		}
+		if err != nil {
+			log.Printf("Error updating topic %s subscriptions for tenant %s: %v", topic, tenantID, err)
+			http.Error(w, "Failed to update topic subscriptions", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
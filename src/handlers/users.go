@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gaulatti/signal/src/database"
+	"github.com/gaulatti/signal/src/middleware"
+	"github.com/gaulatti/signal/src/models"
+	"github.com/gaulatti/signal/src/services"
+)
+
+// UserHandler handles DELETE /users/{user_id}, erasing everything stored about one of the
+// tenant's users. Android devices are first unsubscribed from their recorded FCM topics so topic
+// pushes stop reaching them. Each erasure is recorded in an audit that keeps only a hash of the
+// user ID.
+func UserHandler(topics *services.TopicManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		tenantID := middleware.GetTenantID(r)
+		if tenantID == "" {
+			http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+			return
+		}
+
+		userID := r.PathValue("user_id")
+
+		var devices []models.DeviceToken
+		if err := database.DB.Where("tenant_id = ? AND user_id = ? AND platform = ?", tenantID, userID, models.PlatformAndroid).
+			Find(&devices).Error; err != nil {
+			log.Printf("Error finding devices of user to erase for tenant %s: %v", tenantID, err)
+			http.Error(w, "Failed to erase user", http.StatusInternalServerError)
+			return
+		}
+		for i := range devices {
+			if err := topics.UnsubscribeDevice(tenantID, &devices[i]); err != nil {
+				log.Printf("Error unsubscribing device %d from topics for tenant %s: %v", devices[i].ID, tenantID, err)
+			}
+		}
+
+		audit, err := models.EraseUserData(database.DB, tenantID, userID)
+		if err != nil {
+			log.Printf("Error erasing user for tenant %s: %v", tenantID, err)
+			http.Error(w, "Failed to erase user", http.StatusInternalServerError)
+			return
+		}
+
+		// The user ID is personal data, so only the audit ID is logged
+		log.Printf("User erased for tenant %s: audit=%d, devices=%d, notifications=%d, deliveries=%d",
+			tenantID, audit.ID, audit.DevicesDeleted, audit.NotificationsDeleted, audit.DeliveriesDeleted)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "User data erased successfully",
+			"audit":   audit,
+		})
+	}
+}
+
+// UserExportHandler handles GET /users/{user_id}/export, returning everything stored about one
+// of the tenant's users as a single JSON document
+func UserExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r)
+	if tenantID == "" {
+		http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+		return
+	}
+
+	export, err := models.ExportUserData(database.DB, tenantID, r.PathValue("user_id"))
+	if err != nil {
+		log.Printf("Error exporting user data for tenant %s: %v", tenantID, err)
+		http.Error(w, "Failed to export user data", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="user-export.json"`)
+	json.NewEncoder(w).Encode(export)
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gaulatti/signal/src/middleware"
+	"github.com/gaulatti/signal/src/services"
+)
+
+// WebPushPublicKeyHandler handles GET /webpush/vapid-public-key, returning the tenant's VAPID
+// public key for use as the applicationServerKey of pushManager.subscribe
+func WebPushPublicKeyHandler(webPush *services.WebPushService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		tenantID := middleware.GetTenantID(r)
+		if tenantID == "" {
+			http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+			return
+		}
+
+		publicKey, err := webPush.PublicKey(tenantID)
+		if err != nil {
+			log.Printf("Error loading VAPID key for tenant %s: %v", tenantID, err)
+			http.Error(w, "Web Push is not configured for this tenant", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"public_key": publicKey,
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// MaxBodySize returns a middleware that rejects request bodies over limit bytes with 413
+// Request Entity Too Large. Bodies without a Content-Length are cut off at the limit, and
+// reading past it fails with an *http.MaxBytesError.
+func MaxBodySize(limit int64) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				WriteBodyTooLarge(w, limit)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next(w, r)
+		}
+	}
+}
+
+// WriteBodyTooLarge answers 413 for a request body over limit bytes
+func WriteBodyTooLarge(w http.ResponseWriter, limit int64) {
+	http.Error(w, fmt.Sprintf("Request body too large: at most %d bytes", limit), http.StatusRequestEntityTooLarge)
+}
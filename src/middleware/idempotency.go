@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gaulatti/signal/src/database"
+	"github.com/gaulatti/signal/src/models"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	idempotencyHeader    = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+)
+
+// responseRecorder captures the status and body written by a handler while passing them through
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader records the status code
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the body
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+// IdempotencyMiddleware returns a middleware that honors the Idempotency-Key header per tenant.
+// The first response for a key is stored for ttl and replayed for identical retries, while
+// duplicates arriving before the first request completes are rejected with 409 Conflict. A
+// request in progress only holds its key for lease, so a key orphaned by a crash frees up soon.
+// It must run after AuthMiddleware so the tenant is known.
+func IdempotencyMiddleware(ttl, lease time.Duration) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyHeader)
+			if key == "" {
+				next(w, r)
+				return
+			}
+
+			if len(key) > maxIdempotencyKeyLen {
+				http.Error(w, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLen), http.StatusBadRequest)
+				return
+			}
+
+			tenantID := GetTenantID(r)
+			if tenantID == "" {
+				http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+				return
+			}
+
+			// Read the body so it can be hashed and still be decoded by the handler
+			body, err := io.ReadAll(r.Body)
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				WriteBodyTooLarge(w, maxBytesErr.Limit)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			requestHash := fmt.Sprintf("%x", sha256.Sum256([]byte(r.Method+" "+r.URL.Path+"\n"+string(body))))
+
+			record, acquired, err := acquireIdempotencyKey(tenantID, key, requestHash, lease)
+			if err != nil {
+				log.Printf("Error acquiring idempotency key for tenant %s: %v", tenantID, err)
+				http.Error(w, "Failed to process Idempotency-Key", http.StatusInternalServerError)
+				return
+			}
+
+			if !acquired {
+				replayIdempotentResponse(w, record, requestHash)
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w}
+			next(recorder, r)
+
+			// Responses that depend on the moment rather than the request are not stored, so the
+			// client can retry with the same key
+			if !storableStatus(recorder.status) {
+				if err := database.DB.Delete(record).Error; err != nil {
+					log.Printf("Error releasing idempotency key for tenant %s: %v", tenantID, err)
+				}
+				return
+			}
+
+			if err := database.DB.Model(record).Updates(map[string]interface{}{
+				"status":          models.IdempotencyStatusCompleted,
+				"response_status": recorder.status,
+				"content_type":    recorder.Header().Get("Content-Type"),
+				"response_body":   recorder.body.String(),
+				"expires_at":      time.Now().Add(ttl),
+			}).Error; err != nil {
+				log.Printf("Error storing idempotent response for tenant %s: %v", tenantID, err)
+			}
+		}
+	}
+}
+
+// storableStatus reports whether a response can be replayed for the rest of the TTL. Server
+// errors, 429 (quota or rate limit, which reset) and 409 (a conflicting request in progress)
+// are transient, and replaying them would hide a retry that would now succeed.
+func storableStatus(status int) bool {
+	switch {
+	case status == 0, status >= http.StatusInternalServerError:
+		return false
+	case status == http.StatusTooManyRequests, status == http.StatusConflict:
+		return false
+	}
+	return true
+}
+
+// acquireIdempotencyKey inserts an in-flight record for the key, held for lease. It returns
+// acquired=false with the existing record when the key is already in use and has not expired.
+func acquireIdempotencyKey(tenantID, key, requestHash string, lease time.Duration) (*models.IdempotencyKey, bool, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		record := &models.IdempotencyKey{
+			TenantID:    tenantID,
+			Key:         key,
+			RequestHash: requestHash,
+			Status:      models.IdempotencyStatusInFlight,
+			ExpiresAt:   time.Now().Add(lease),
+		}
+
+		result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil {
+			return nil, false, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return record, true, nil
+		}
+
+		var existing models.IdempotencyKey
+		if err := database.DB.Where("tenant_id = ? AND idempotency_key = ?", tenantID, key).First(&existing).Error; err != nil {
+			return nil, false, err
+		}
+
+		if existing.ExpiresAt.After(time.Now()) {
+			return &existing, false, nil
+		}
+
+		// The previous record expired; remove it and try to claim the key again
+		if err := database.DB.Where("id = ? AND expires_at < ?", existing.ID, time.Now()).
+			Delete(&models.IdempotencyKey{}).Error; err != nil {
+			return nil, false, err
+		}
+	}
+
+	return nil, false, fmt.Errorf("idempotency key %q is contended", key)
+}
+
+// replayIdempotentResponse answers a duplicate request from the stored record
+func replayIdempotentResponse(w http.ResponseWriter, record *models.IdempotencyKey, requestHash string) {
+	if record.RequestHash != requestHash {
+		http.Error(w, "Idempotency-Key was already used with a different request", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if record.Status != models.IdempotencyStatusCompleted {
+		w.Header().Set("Retry-After", strconv.Itoa(1))
+		http.Error(w, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+		return
+	}
+
+	if record.ContentType != "" {
+		w.Header().Set("Content-Type", record.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.ResponseStatus)
+	io.WriteString(w, record.ResponseBody)
+}
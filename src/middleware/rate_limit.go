@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gaulatti/signal/src/database"
+	"github.com/gaulatti/signal/src/models"
+)
+
+// tokenBucket is a per-tenant request rate limiter
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// tenantLimits caches the limits configured on a tenant record
+type tenantLimits struct {
+	ratePerSecond float64
+	burst         int
+	dailyQuota    int64
+	monthlyQuota  int64
+	loadedAt      time.Time
+}
+
+// RateLimiter enforces per-tenant request rate limits and push quotas stored on the Tenant record.
+// Token buckets live in process memory, so rate limits apply per instance; quotas are reserved in
+// the database and shared.
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket  // tenantID -> bucket
+	limits  map[string]*tenantLimits // tenantID -> cached limits
+	refresh time.Duration
+}
+
+// NewRateLimiter creates a rate limiter that reloads tenant limits every refresh interval
+func NewRateLimiter(refresh time.Duration) *RateLimiter {
+	return &RateLimiter{
+		buckets: make(map[string]*tokenBucket),
+		limits:  make(map[string]*tenantLimits),
+		refresh: refresh,
+	}
+}
+
+// getLimits returns the cached limits of a tenant, reloading them when stale
+func (l *RateLimiter) getLimits(tenantID string) tenantLimits {
+	l.mu.Lock()
+	cached, exists := l.limits[tenantID]
+	l.mu.Unlock()
+
+	if exists && time.Since(cached.loadedAt) < l.refresh {
+		return *cached
+	}
+
+	limits := &tenantLimits{loadedAt: time.Now()}
+	tenant, err := models.GetTenantByID(database.DB, tenantID)
+	if err != nil {
+		log.Printf("Error loading limits for tenant %s: %v", tenantID, err)
+		// Keep enforcing the previous limits rather than failing open or closed
+		if exists {
+			limits = cached
+			limits.loadedAt = time.Now()
+		}
+	} else {
+		limits.ratePerSecond = tenant.RateLimitPerSecond
+		limits.burst = tenant.RateLimitBurst
+		limits.dailyQuota = tenant.DailyPushQuota
+		limits.monthlyQuota = tenant.MonthlyPushQuota
+	}
+
+	l.mu.Lock()
+	l.limits[tenantID] = limits
+	l.mu.Unlock()
+
+	return *limits
+}
+
+// take removes a token from the tenant's bucket. It returns whether the request is allowed,
+// the tokens left and how long until the next token is available.
+func (l *RateLimiter) take(tenantID string, limits tenantLimits) (bool, int, time.Duration) {
+	burst := float64(limits.burst)
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(limits.ratePerSecond))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	bucket, exists := l.buckets[tenantID]
+	if !exists {
+		bucket = &tokenBucket{tokens: burst, last: now}
+		l.buckets[tenantID] = bucket
+	}
+
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.last).Seconds()*limits.ratePerSecond)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, int(bucket.tokens), 0
+	}
+
+	wait := time.Duration((1 - bucket.tokens) / limits.ratePerSecond * float64(time.Second))
+	return false, 0, wait
+}
+
+// Limit is a middleware that applies the tenant's request rate limit. It must run after
+// AuthMiddleware so the tenant is known.
+func (l *RateLimiter) Limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := GetTenantID(r)
+		if tenantID == "" {
+			http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+			return
+		}
+
+		limits := l.getLimits(tenantID)
+		if limits.ratePerSecond <= 0 {
+			next(w, r)
+			return
+		}
+
+		allowed, remaining, wait := l.take(tenantID, limits)
+		burst := limits.burst
+		if burst < 1 {
+			burst = int(math.Max(1, math.Ceil(limits.ratePerSecond)))
+		}
+
+		// Seconds until the bucket refills completely
+		reset := math.Ceil((float64(burst) - float64(remaining)) / limits.ratePerSecond)
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(reset)))
+
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// Quota is a middleware that rejects push requests once the tenant's daily or monthly push
+// quota has been used up, before the target is resolved. It is only a shortcut: the queue
+// checks the exact number of deliveries against the remaining quota when it records them.
+// It must run after AuthMiddleware so the tenant is known.
+func (l *RateLimiter) Quota(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := GetTenantID(r)
+		if tenantID == "" {
+			http.Error(w, "Unable to determine tenant", http.StatusInternalServerError)
+			return
+		}
+
+		limits := l.getLimits(tenantID)
+		now := time.Now().UTC()
+
+		quotas := []struct {
+			name   string
+			limit  int64
+			period string
+			resets time.Time
+		}{
+			{"daily", limits.dailyQuota, models.DailyPeriod(now), models.NextDailyPeriod(now)},
+			{"monthly", limits.monthlyQuota, models.MonthlyPeriod(now), models.NextMonthlyPeriod(now)},
+		}
+
+		for _, quota := range quotas {
+			if quota.limit <= 0 {
+				continue
+			}
+
+			used, err := models.GetTenantUsage(database.DB, tenantID, quota.period)
+			if err != nil {
+				log.Printf("Error loading %s usage for tenant %s: %v", quota.name, tenantID, err)
+				http.Error(w, "Failed to check push quota", http.StatusInternalServerError)
+				return
+			}
+
+			if used >= quota.limit {
+				retryAfter := int(math.Ceil(time.Until(quota.resets).Seconds()))
+				w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(quota.limit, 10))
+				w.Header().Set("X-RateLimit-Remaining", "0")
+				w.Header().Set("X-RateLimit-Reset", strconv.Itoa(retryAfter))
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				http.Error(w, fmt.Sprintf("%s push quota of %d exceeded", quota.name, quota.limit), http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
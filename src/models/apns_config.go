@@ -4,6 +4,12 @@ import (
 	"time"
 )
 
+// APNS environments
+const (
+	APNSEnvironmentProduction = "production"
+	APNSEnvironmentSandbox    = "sandbox"
+)
+
 // APNSConfig represents APNS configuration for tenants
 type APNSConfig struct {
 	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
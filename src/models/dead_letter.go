@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// DeadLetter records a push job that failed permanently or exhausted its retries
+type DeadLetter struct {
+	ID             uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	JobID          uint       `gorm:"not null;index" json:"job_id"`
+	NotificationID string     `gorm:"type:varchar(36);not null;index" json:"notification_id"`
+	DeliveryID     uint       `json:"delivery_id"`
+	TenantID       string     `gorm:"type:varchar(255);not null;index" json:"tenant_id"`
+	DeviceID       uint       `json:"device_id,omitempty"`
+	UserID         string     `gorm:"type:varchar(255)" json:"user_id,omitempty"`
+	Platform       string     `gorm:"type:varchar(100);not null" json:"platform"`
+	DeviceToken    string     `gorm:"type:varchar(500);not null" json:"device_token"`
+	Environment    string     `gorm:"type:varchar(20)" json:"environment,omitempty"`
+	Payload        string     `gorm:"type:mediumtext;not null" json:"payload"`
+	Attempts       int        `json:"attempts"`
+	LastError      string     `gorm:"type:text" json:"last_error"`
+	ReplayedAt     *time.Time `json:"replayed_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
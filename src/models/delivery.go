@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// Delivery statuses
+const (
+	DeliveryStatusPending = "pending"
+	DeliveryStatusSent    = "sent"
+	DeliveryStatusFailed  = "failed"
+)
+
+// Delivery records the outcome of a notification for a single device
+type Delivery struct {
+	ID                uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	NotificationID    string     `gorm:"type:varchar(36);not null;index;index:idx_deliveries_notification_status,priority:1" json:"notification_id"`
+	TenantID          string     `gorm:"type:varchar(255);not null;index:idx_deliveries_tenant_user,priority:1" json:"tenant_id"`
+	DeviceID          uint       `gorm:"index" json:"device_id,omitempty"`
+	UserID            string     `gorm:"type:varchar(255);index:idx_deliveries_tenant_user,priority:2" json:"user_id,omitempty"`
+	Platform          string     `gorm:"type:varchar(100);not null" json:"platform"`
+	DeviceToken       string     `gorm:"type:varchar(500);not null" json:"device_token"`
+	Provider          string     `gorm:"type:varchar(50)" json:"provider"`
+	ProviderMessageID string     `gorm:"type:varchar(255)" json:"provider_message_id,omitempty"` // apns-id or FCM message name
+	Status            string     `gorm:"type:varchar(50);not null;index:idx_deliveries_notification_status,priority:2" json:"status"`
+	Error             string     `gorm:"type:text" json:"error,omitempty"`
+	Attempts          int        `gorm:"default:0" json:"attempts"`
+	HeldUntil         *time.Time `json:"held_until,omitempty"` // local-time or quiet-hours release
+	SentAt            *time.Time `json:"sent_at,omitempty"`
+	CreatedAt         time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
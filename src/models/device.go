@@ -1,16 +1,214 @@
 package models
 
 import (
+	"errors"
 	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Supported device platforms
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformWeb     = "web" // browser Web Push subscriptions; DeviceToken holds the endpoint URL
 )
 
 // DeviceToken represents device registrations scoped to tenants
 type DeviceToken struct {
-	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	TenantID    string    `gorm:"type:varchar(255);not null;index" json:"tenant_id"`
-	DeviceToken string    `gorm:"type:varchar(500);not null" json:"device_token"`
-	UserID      string    `gorm:"type:varchar(255);not null" json:"user_id"`
-	Platform    string    `gorm:"type:varchar(100);not null" json:"platform"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID       string    `gorm:"type:varchar(255);not null;index;uniqueIndex:idx_device_tokens_tenant_token,priority:1;index:idx_device_tokens_installation,priority:1" json:"tenant_id"`
+	DeviceToken    string    `gorm:"type:varchar(500);not null;uniqueIndex:idx_device_tokens_tenant_token,priority:2" json:"device_token"`
+	InstallationID string    `gorm:"type:varchar(255);index:idx_device_tokens_installation,priority:2" json:"installation_id,omitempty"` // client-generated, stable across token refreshes
+	UserID         string    `gorm:"type:varchar(255);not null" json:"user_id"`
+	Platform       string    `gorm:"type:varchar(100);not null" json:"platform"`
+	Timezone       string    `gorm:"type:varchar(64)" json:"timezone,omitempty"`    // IANA name, e.g. "Europe/Madrid"
+	Locale         string    `gorm:"type:varchar(35)" json:"locale,omitempty"`      // BCP 47, e.g. "es-MX"
+	Environment    string    `gorm:"type:varchar(20)" json:"environment,omitempty"` // APNS environment an iOS token was registered for, if hinted
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Deactivation is recorded when a provider reports the token as invalid
+	Active             bool       `gorm:"not null;default:true;index" json:"active"`
+	DeactivatedAt      *time.Time `json:"deactivated_at,omitempty"`
+	DeactivationReason string     `gorm:"type:varchar(255)" json:"deactivation_reason,omitempty"`
+
+	// Web Push subscription keys (base64url), set for the web platform only
+	WebPushP256DH string `gorm:"column:webpush_p256dh;type:varchar(100)" json:"-"`
+	WebPushAuth   string `gorm:"column:webpush_auth;type:varchar(50)" json:"-"`
+}
+
+// RegisterDevice creates or updates a device registration and returns the token the registration
+// had before, if any. The registration is found by installation ID when one is given, otherwise
+// by token. A token belongs to exactly one registration: another registration still holding it,
+// e.g. from before the installation ID was sent or from a previous user of the phone, is deleted.
+func RegisterDevice(db *gorm.DB, device *DeviceToken) (string, error) {
+	previousToken := ""
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Each lookup starts from a fresh locking query so their conditions don't accumulate
+		locked := func() *gorm.DB {
+			return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+
+		var byInstallation *DeviceToken
+		if device.InstallationID != "" {
+			var found DeviceToken
+			err := locked().Where("tenant_id = ? AND installation_id = ?", device.TenantID, device.InstallationID).
+				Order("id DESC").
+				First(&found).Error
+			switch {
+			case err == nil:
+				byInstallation = &found
+			case !errors.Is(err, gorm.ErrRecordNotFound):
+				return err
+			}
+		}
+
+		var byToken *DeviceToken
+		var found DeviceToken
+		err := locked().Where("tenant_id = ? AND device_token = ?", device.TenantID, device.DeviceToken).First(&found).Error
+		switch {
+		case err == nil:
+			byToken = &found
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		var duplicateID uint
+		previousToken, duplicateID = resolveRegistration(device, byInstallation, byToken)
+		if duplicateID != 0 {
+			if err := DeleteDevices(tx, device.TenantID, []uint{duplicateID}); err != nil {
+				return err
+			}
+		}
+		return tx.Save(device).Error
+	})
+
+	return previousToken, err
+}
+
+// resolveRegistration decides how RegisterDevice stores device, given the registration holding
+// its installation ID and the one holding its token, either nil when there is none. It fills
+// device in from the registration it replaces and returns that registration's token and the ID
+// of a registration that must be deleted because it still holds the token, or zero.
+func resolveRegistration(device *DeviceToken, byInstallation, byToken *DeviceToken) (string, uint) {
+	existing := byInstallation
+	var duplicateID uint
+	switch {
+	case existing == nil:
+		existing = byToken
+	case byToken != nil && byToken.ID != existing.ID:
+		duplicateID = byToken.ID
+	}
+
+	previousToken := ""
+	if existing != nil {
+		previousToken = existing.DeviceToken
+		device.ID = existing.ID
+		device.CreatedAt = existing.CreatedAt
+		if device.InstallationID == "" {
+			device.InstallationID = existing.InstallationID
+		}
+	}
+
+	// Registering reactivates a token that was previously pruned
+	device.Active = true
+	device.DeactivatedAt = nil
+	device.DeactivationReason = ""
+	return previousToken, duplicateID
+}
+
+// DeleteDevices deletes a tenant's device registrations together with their attributes, tags and
+// topic subscription records
+func DeleteDevices(db *gorm.DB, tenantID string, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tenant_id = ? AND device_id IN ?", tenantID, ids).Delete(&DeviceAttribute{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tenant_id = ? AND device_id IN ?", tenantID, ids).Delete(&TopicSubscription{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("tenant_id = ? AND id IN ?", tenantID, ids).Delete(&DeviceToken{}).Error
+	})
+}
+
+// DeviceFilter narrows a device listing; empty fields match every device
+type DeviceFilter struct {
+	UserID       string
+	Platform     string
+	Environment  string // APNS environment hinted at registration
+	UpdatedSince *time.Time
+}
+
+// GetDevice returns one of a tenant's device registrations
+func GetDevice(db *gorm.DB, tenantID string, id uint) (*DeviceToken, error) {
+	var device DeviceToken
+	if err := db.Where("tenant_id = ? AND id = ?", tenantID, id).First(&device).Error; err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// ListDevices returns up to limit of a tenant's device registrations matching filter, in ID order,
+// starting after the device with ID afterID
+func ListDevices(db *gorm.DB, tenantID string, filter DeviceFilter, afterID uint, limit int) ([]DeviceToken, error) {
+	query := db.Where("tenant_id = ? AND id > ?", tenantID, afterID)
+	if filter.UserID != "" {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Platform != "" {
+		query = query.Where("platform = ?", filter.Platform)
+	}
+	if filter.Environment != "" {
+		query = query.Where("environment = ?", filter.Environment)
+	}
+	if filter.UpdatedSince != nil {
+		query = query.Where("updated_at >= ?", *filter.UpdatedSince)
+	}
+
+	var devices []DeviceToken
+	err := query.Order("id").Limit(limit).Find(&devices).Error
+	return devices, err
+}
+
+// FindDevices returns the registrations of a tenant holding a token or belonging to an
+// installation. Empty arguments match nothing.
+func FindDevices(db *gorm.DB, tenantID, deviceToken, installationID string) ([]DeviceToken, error) {
+	var devices []DeviceToken
+	err := db.Where("tenant_id = ?", tenantID).
+		Where(db.Where("device_token = ? AND device_token <> ''", deviceToken).
+			Or("installation_id = ? AND installation_id <> ''", installationID)).
+		Find(&devices).Error
+	return devices, err
+}
+
+// DeactivateDeviceToken marks every active registration of a token as inactive, recording why.
+// It returns the number of rows deactivated.
+func DeactivateDeviceToken(db *gorm.DB, tenantID, deviceToken, reason string) (int64, error) {
+	result := db.Model(&DeviceToken{}).
+		Where("tenant_id = ? AND device_token = ? AND active = ?", tenantID, deviceToken, true).
+		Updates(map[string]interface{}{
+			"active":              false,
+			"deactivated_at":      time.Now(),
+			"deactivation_reason": reason,
+		})
+	return result.RowsAffected, result.Error
+}
+
+// GetWebPushSubscription returns the most recent active web registration of an endpoint
+func GetWebPushSubscription(db *gorm.DB, tenantID, endpoint string) (*DeviceToken, error) {
+	var device DeviceToken
+	err := db.Where("tenant_id = ? AND device_token = ? AND platform = ? AND active = ?", tenantID, endpoint, PlatformWeb, true).
+		Order("id DESC").
+		First(&device).Error
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
 }
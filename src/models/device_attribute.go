@@ -0,0 +1,84 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AttributeKeyTag is the key under which device tags are stored; a device can have many
+const AttributeKeyTag = "tag"
+
+// DeviceAttribute is a key/value attribute or tag of a registered device, used for segment targeting
+type DeviceAttribute struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"-"`
+	TenantID  string    `gorm:"type:varchar(255);not null;index" json:"-"`
+	DeviceID  uint      `gorm:"not null;uniqueIndex:idx_device_attribute,priority:1" json:"-"`
+	Key       string    `gorm:"column:attribute_key;type:varchar(64);not null;uniqueIndex:idx_device_attribute,priority:2;index:idx_device_attribute_lookup,priority:1" json:"key"`
+	Value     string    `gorm:"column:attribute_value;type:varchar(255);not null;uniqueIndex:idx_device_attribute,priority:3;index:idx_device_attribute_lookup,priority:2" json:"value"`
+	CreatedAt time.Time `json:"-"`
+}
+
+// SetDeviceAttributes replaces the key/value attributes of a device, leaving its tags untouched
+func SetDeviceAttributes(db *gorm.DB, tenantID string, deviceID uint, attributes map[string]string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("device_id = ? AND attribute_key <> ?", deviceID, AttributeKeyTag).
+			Delete(&DeviceAttribute{}).Error; err != nil {
+			return err
+		}
+
+		if len(attributes) == 0 {
+			return nil
+		}
+
+		rows := make([]DeviceAttribute, 0, len(attributes))
+		for key, value := range attributes {
+			rows = append(rows, DeviceAttribute{TenantID: tenantID, DeviceID: deviceID, Key: key, Value: value})
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+// SetDeviceTags replaces the tags of a device, leaving its other attributes untouched
+func SetDeviceTags(db *gorm.DB, tenantID string, deviceID uint, tags []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("device_id = ? AND attribute_key = ?", deviceID, AttributeKeyTag).
+			Delete(&DeviceAttribute{}).Error; err != nil {
+			return err
+		}
+
+		seen := make(map[string]bool, len(tags))
+		rows := make([]DeviceAttribute, 0, len(tags))
+		for _, tag := range tags {
+			if seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			rows = append(rows, DeviceAttribute{TenantID: tenantID, DeviceID: deviceID, Key: AttributeKeyTag, Value: tag})
+		}
+
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+// GetDeviceAttributes returns the attributes and tags of a device
+func GetDeviceAttributes(db *gorm.DB, deviceID uint) (map[string]string, []string, error) {
+	var rows []DeviceAttribute
+	if err := db.Where("device_id = ?", deviceID).Order("attribute_key, attribute_value").Find(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+
+	attributes := make(map[string]string)
+	tags := []string{}
+	for _, row := range rows {
+		if row.Key == AttributeKeyTag {
+			tags = append(tags, row.Value)
+		} else {
+			attributes[row.Key] = row.Value
+		}
+	}
+	return attributes, tags, nil
+}
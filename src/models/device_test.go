@@ -0,0 +1,109 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveRegistration(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	deactivatedAt := createdAt.Add(time.Hour)
+
+	tests := []struct {
+		name             string
+		register         DeviceToken
+		byInstallation   *DeviceToken
+		byToken          *DeviceToken
+		wantID           uint
+		wantInstallation string
+		wantPrevious     string
+		wantDuplicate    uint
+	}{
+		{
+			name:             "new registration",
+			register:         DeviceToken{DeviceToken: "token-1", InstallationID: "install-a", UserID: "alice"},
+			wantInstallation: "install-a",
+		},
+		{
+			name:             "token moves to another installation",
+			register:         DeviceToken{DeviceToken: "token-1", InstallationID: "install-b", UserID: "carol"},
+			byInstallation:   &DeviceToken{ID: 2, DeviceToken: "token-2", InstallationID: "install-b", UserID: "bob", CreatedAt: createdAt},
+			byToken:          &DeviceToken{ID: 1, DeviceToken: "token-1", InstallationID: "install-a", UserID: "alice"},
+			wantID:           2,
+			wantInstallation: "install-b",
+			wantPrevious:     "token-2",
+			wantDuplicate:    1,
+		},
+		{
+			name:         "token moves to another user",
+			register:     DeviceToken{DeviceToken: "token-1", UserID: "bob"},
+			byToken:      &DeviceToken{ID: 1, DeviceToken: "token-1", UserID: "alice", CreatedAt: createdAt},
+			wantID:       1,
+			wantPrevious: "token-1",
+		},
+		{
+			name:             "installation refreshes its token",
+			register:         DeviceToken{DeviceToken: "token-2", InstallationID: "install-a", UserID: "alice"},
+			byInstallation:   &DeviceToken{ID: 1, DeviceToken: "token-1", InstallationID: "install-a", UserID: "alice", CreatedAt: createdAt},
+			wantID:           1,
+			wantInstallation: "install-a",
+			wantPrevious:     "token-1",
+		},
+		{
+			name:             "installation and token match the same registration",
+			register:         DeviceToken{DeviceToken: "token-1", InstallationID: "install-a", UserID: "alice"},
+			byInstallation:   &DeviceToken{ID: 1, DeviceToken: "token-1", InstallationID: "install-a", CreatedAt: createdAt},
+			byToken:          &DeviceToken{ID: 1, DeviceToken: "token-1", InstallationID: "install-a", CreatedAt: createdAt},
+			wantID:           1,
+			wantInstallation: "install-a",
+			wantPrevious:     "token-1",
+		},
+		{
+			name:             "installation ID is kept when omitted",
+			register:         DeviceToken{DeviceToken: "token-1", UserID: "bob"},
+			byToken:          &DeviceToken{ID: 1, DeviceToken: "token-1", InstallationID: "install-a", UserID: "alice", CreatedAt: createdAt},
+			wantID:           1,
+			wantInstallation: "install-a",
+			wantPrevious:     "token-1",
+		},
+		{
+			name:     "pruned token is reactivated",
+			register: DeviceToken{DeviceToken: "token-1", UserID: "alice"},
+			byToken: &DeviceToken{ID: 1, DeviceToken: "token-1", UserID: "alice", CreatedAt: createdAt,
+				Active: false, DeactivatedAt: &deactivatedAt, DeactivationReason: "Unregistered"},
+			wantID:       1,
+			wantPrevious: "token-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := tt.register
+			previous, duplicate := resolveRegistration(&device, tt.byInstallation, tt.byToken)
+
+			if device.ID != tt.wantID {
+				t.Errorf("device.ID = %d, want %d", device.ID, tt.wantID)
+			}
+			if device.InstallationID != tt.wantInstallation {
+				t.Errorf("device.InstallationID = %q, want %q", device.InstallationID, tt.wantInstallation)
+			}
+			if previous != tt.wantPrevious {
+				t.Errorf("previous token = %q, want %q", previous, tt.wantPrevious)
+			}
+			if duplicate != tt.wantDuplicate {
+				t.Errorf("duplicate ID = %d, want %d", duplicate, tt.wantDuplicate)
+			}
+			if device.UserID != tt.register.UserID || device.DeviceToken != tt.register.DeviceToken {
+				t.Errorf("device = {token %q, user %q}, want the registered {token %q, user %q}",
+					device.DeviceToken, device.UserID, tt.register.DeviceToken, tt.register.UserID)
+			}
+			if tt.wantID != 0 && !device.CreatedAt.Equal(createdAt) {
+				t.Errorf("device.CreatedAt = %v, want the existing registration's %v", device.CreatedAt, createdAt)
+			}
+			if !device.Active || device.DeactivatedAt != nil || device.DeactivationReason != "" {
+				t.Errorf("device is not active: active %v, deactivated at %v, reason %q",
+					device.Active, device.DeactivatedAt, device.DeactivationReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Idempotency key statuses
+const (
+	IdempotencyStatusInFlight  = "in_flight"
+	IdempotencyStatusCompleted = "completed"
+)
+
+// IdempotencyKey stores the response of a request made with an Idempotency-Key header
+type IdempotencyKey struct {
+	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID       string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_tenant_key,priority:1" json:"tenant_id"`
+	Key            string    `gorm:"column:idempotency_key;type:varchar(255);not null;uniqueIndex:idx_idempotency_tenant_key,priority:2" json:"key"`
+	RequestHash    string    `gorm:"type:varchar(64);not null" json:"request_hash"` // SHA-256 of method, path and body
+	Status         string    `gorm:"type:varchar(50);not null" json:"status"`
+	ResponseStatus int       `json:"response_status"`
+	ContentType    string    `gorm:"type:varchar(255)" json:"content_type"`
+	ResponseBody   string    `gorm:"type:mediumtext" json:"response_body"`
+	ExpiresAt      time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// PurgeExpiredIdempotencyKeys deletes stored responses whose replay window has passed
+func PurgeExpiredIdempotencyKeys(db *gorm.DB) (int64, error) {
+	result := db.Where("expires_at < ?", time.Now()).Delete(&IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
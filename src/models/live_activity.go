@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Live Activity token types
+const (
+	// LiveActivityTokenUpdate is the per-activity token used to update and end a running activity
+	LiveActivityTokenUpdate = "update"
+	// LiveActivityTokenPushToStart is the per-app token used to start a new activity remotely (iOS 17.2+)
+	LiveActivityTokenPushToStart = "push_to_start"
+)
+
+// LiveActivityToken stores the APNS push tokens of iOS Live Activities. They are kept apart
+// from DeviceToken because each running activity has its own token and a short lifetime.
+type LiveActivityToken struct {
+	ID             uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID       string     `gorm:"type:varchar(255);not null;uniqueIndex:idx_live_activity_tenant_token,priority:1" json:"tenant_id"`
+	PushToken      string     `gorm:"type:varchar(255);not null;uniqueIndex:idx_live_activity_tenant_token,priority:2" json:"push_token"`
+	TokenType      string     `gorm:"type:varchar(20);not null" json:"token_type"`
+	ActivityID     string     `gorm:"type:varchar(255);index" json:"activity_id,omitempty"` // app-defined activity identifier
+	AttributesType string     `gorm:"type:varchar(255)" json:"attributes_type,omitempty"`
+	DeviceToken    string     `gorm:"type:varchar(500)" json:"device_token,omitempty"` // regular APNS token of the device
+	UserID         string     `gorm:"type:varchar(255);index" json:"user_id,omitempty"`
+	Active         bool       `gorm:"not null;default:true" json:"active"`
+	EndedAt        *time.Time `json:"ended_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// EndLiveActivityToken marks an activity token as no longer usable, e.g. after an end event
+// or when APNS reports it as invalid. It returns the number of rows updated.
+func EndLiveActivityToken(db *gorm.DB, tenantID, pushToken string) (int64, error) {
+	result := db.Model(&LiveActivityToken{}).
+		Where("tenant_id = ? AND push_token = ? AND active = ?", tenantID, pushToken, true).
+		Updates(map[string]interface{}{
+			"active":   false,
+			"ended_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
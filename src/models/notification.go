@@ -0,0 +1,115 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notification statuses
+const (
+	NotificationStatusScheduled = "scheduled"
+	NotificationStatusQueued    = "queued"
+	NotificationStatusCancelled = "cancelled"
+	NotificationStatusFailed    = "failed" // a scheduled notification that could not be dispatched
+)
+
+// Notification target types
+const (
+	TargetTenant    = "tenant"    // every device of the tenant
+	TargetUser      = "user"      // every device of one user
+	TargetDevice    = "device"    // a single device token
+	TargetTopic     = "topic"     // subscribers of an FCM topic
+	TargetCondition = "condition" // subscribers matching an FCM topic condition
+	TargetSegment   = "segment"   // devices matching a segment expression
+)
+
+// Notification represents a push request accepted by Signal
+type Notification struct {
+	ID          string     `gorm:"type:varchar(36);primaryKey" json:"id"`
+	TenantID    string     `gorm:"type:varchar(255);not null;index;index:idx_notifications_tenant_user,priority:1" json:"tenant_id"`
+	TargetType  string     `gorm:"type:varchar(50);not null" json:"target_type"`
+	Target      string     `gorm:"type:varchar(500)" json:"target,omitempty"`
+	UserID      string     `gorm:"type:varchar(255);index:idx_notifications_tenant_user,priority:2" json:"user_id,omitempty"` // user a device-targeted send was made for, if given
+	PayloadHash string     `gorm:"type:varchar(64);not null" json:"payload_hash"`                                             // SHA-256 of the message content
+	Status      string     `gorm:"type:varchar(50);not null;index:idx_notifications_status_send_at,priority:1" json:"status"`
+	SendAt      *time.Time `gorm:"index:idx_notifications_status_send_at,priority:2" json:"send_at,omitempty"`
+	Payload     string     `gorm:"type:mediumtext" json:"-"`              // target and message kept until a scheduled send is dispatched
+	Attempts    int        `gorm:"default:0" json:"attempts,omitempty"`   // failed dispatch attempts of a scheduled send
+	LastError   string     `gorm:"type:text" json:"last_error,omitempty"` // error of the last failed dispatch attempt
+	CreatedAt   time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Deliveries  []Delivery `gorm:"foreignKey:NotificationID" json:"deliveries,omitempty"`
+}
+
+// DeliveryFilter narrows a notification's delivery listing; empty fields match every delivery
+type DeliveryFilter struct {
+	UserID string
+	Status string
+}
+
+// GetNotification returns a tenant's notification without its deliveries, which a broadcast can
+// have hundreds of thousands of; see CountDeliveriesByStatus and ListDeliveries
+func GetNotification(db *gorm.DB, tenantID, notificationID string) (*Notification, error) {
+	var notification Notification
+	err := db.Where("tenant_id = ? AND id = ?", tenantID, notificationID).First(&notification).Error
+	if err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// CountDeliveriesByStatus returns the number of deliveries of a notification per status
+func CountDeliveriesByStatus(db *gorm.DB, tenantID, notificationID string) (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	err := db.Model(&Delivery{}).
+		Select("status, COUNT(*) AS count").
+		Where("tenant_id = ? AND notification_id = ?", tenantID, notificationID).
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// ListDeliveries returns up to limit deliveries of a notification matching filter, in ID order,
+// starting after the delivery with ID afterID
+func ListDeliveries(db *gorm.DB, tenantID, notificationID string, filter DeliveryFilter, afterID uint, limit int) ([]Delivery, error) {
+	query := db.Where("tenant_id = ? AND notification_id = ? AND id > ?", tenantID, notificationID, afterID)
+	if filter.UserID != "" {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var deliveries []Delivery
+	err := query.Order("id").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// ListNotifications returns a tenant's most recent notifications. When userID is set only
+// notifications delivered to that user are returned, each with that user's deliveries.
+func ListNotifications(db *gorm.DB, tenantID, userID string, limit int) ([]Notification, error) {
+	query := db.Where("tenant_id = ?", tenantID)
+
+	if userID != "" {
+		query = query.Where("id IN (?)", db.Model(&Delivery{}).
+			Select("notification_id").
+			Where("tenant_id = ? AND user_id = ?", tenantID, userID)).
+			Preload("Deliveries", "user_id = ?", userID)
+	}
+
+	var notifications []Notification
+	err := query.Order("created_at DESC").Limit(limit).Find(&notifications).Error
+	return notifications, err
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// Push job statuses
+const (
+	JobStatusPending    = "pending"
+	JobStatusProcessing = "processing"
+	JobStatusSent       = "sent"
+	JobStatusFailed     = "failed"
+)
+
+// PushJob represents a queued push delivery to a single device
+type PushJob struct {
+	ID             uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	NotificationID string     `gorm:"type:varchar(36);not null;index" json:"notification_id"`
+	DeliveryID     uint       `gorm:"index" json:"delivery_id"`
+	TenantID       string     `gorm:"type:varchar(255);not null;index" json:"tenant_id"`
+	DeviceID       uint       `gorm:"index" json:"device_id,omitempty"`
+	UserID         string     `gorm:"type:varchar(255)" json:"user_id,omitempty"`
+	Platform       string     `gorm:"type:varchar(100);not null" json:"platform"`
+	DeviceToken    string     `gorm:"type:varchar(500);not null" json:"device_token"`
+	Environment    string     `gorm:"type:varchar(20)" json:"environment,omitempty"` // APNS environment of the device, if hinted
+	Payload        string     `gorm:"type:mediumtext;not null" json:"-"`             // JSON-encoded message content, untruncated
+	Status         string     `gorm:"type:varchar(50);not null;default:'pending';index:idx_push_jobs_claim,priority:1" json:"status"`
+	Attempts       int        `gorm:"default:0" json:"attempts"`
+	LastError      string     `gorm:"type:text" json:"last_error,omitempty"`
+	AvailableAt    time.Time  `gorm:"not null;index:idx_push_jobs_claim,priority:2" json:"available_at"`
+	LockedAt       *time.Time `json:"-"`
+	CompletedAt    *time.Time `gorm:"index" json:"completed_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// retentionBatchSize bounds the rows deleted per statement, so purges don't hold long locks
+const retentionBatchSize = 1000
+
+// PurgeCompletedPushJobs deletes sent and failed push jobs completed before cutoff. Dead letters
+// keep their own copy of failed jobs, so those can still be replayed.
+func PurgeCompletedPushJobs(db *gorm.DB, cutoff time.Time) (int64, error) {
+	return deleteInBatches(func() *gorm.DB {
+		return db.Where("status IN ? AND completed_at < ?", []string{JobStatusSent, JobStatusFailed}, cutoff)
+	}, &PushJob{})
+}
+
+// PurgeOldDeliveries deletes sent and failed deliveries created before cutoff. Pending ones,
+// including those held for a delivery window, are kept until they complete.
+func PurgeOldDeliveries(db *gorm.DB, cutoff time.Time) (int64, error) {
+	return deleteInBatches(func() *gorm.DB {
+		return db.Where("status IN ? AND created_at < ?", []string{DeliveryStatusSent, DeliveryStatusFailed}, cutoff)
+	}, &Delivery{})
+}
+
+// deleteInBatches deletes the rows matched by scope retentionBatchSize at a time until none are left
+func deleteInBatches(scope func() *gorm.DB, model interface{}) (int64, error) {
+	var total int64
+	for {
+		result := scope().Limit(retentionBatchSize).Delete(model)
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < retentionBatchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Template is a tenant's reusable notification text with one variant per locale
+type Template struct {
+	ID            uint              `gorm:"primaryKey;autoIncrement" json:"-"`
+	TenantID      string            `gorm:"type:varchar(255);not null;uniqueIndex:idx_templates_tenant_template,priority:1" json:"tenant_id"`
+	TemplateID    string            `gorm:"type:varchar(100);not null;uniqueIndex:idx_templates_tenant_template,priority:2" json:"template_id"`
+	DefaultLocale string            `gorm:"type:varchar(35);not null" json:"default_locale"` // used when no variant matches the device
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	Variants      []TemplateVariant `gorm:"foreignKey:TemplateRowID;constraint:OnDelete:CASCADE" json:"variants"`
+}
+
+// TemplateVariant holds the title and body of a template in one locale, written with
+// text/template placeholders such as {{.order_id}}
+type TemplateVariant struct {
+	ID            uint   `gorm:"primaryKey;autoIncrement" json:"-"`
+	TemplateRowID uint   `gorm:"not null;uniqueIndex:idx_template_variants_locale,priority:1" json:"-"`
+	Locale        string `gorm:"type:varchar(35);not null;uniqueIndex:idx_template_variants_locale,priority:2" json:"locale"` // BCP 47, e.g. "es" or "pt-BR"
+	Title         string `gorm:"type:text;not null" json:"title"`
+	Body          string `gorm:"type:text;not null" json:"body"`
+}
+
+// GetTemplate returns a tenant's template with its variants
+func GetTemplate(db *gorm.DB, tenantID, templateID string) (*Template, error) {
+	var template Template
+	err := db.Preload("Variants").
+		Where("tenant_id = ? AND template_id = ?", tenantID, templateID).
+		First(&template).Error
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// SaveTemplate creates or replaces a template and all of its variants
+func SaveTemplate(db *gorm.DB, template *Template) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var existing Template
+		err := tx.Where("tenant_id = ? AND template_id = ?", template.TenantID, template.TemplateID).First(&existing).Error
+		switch {
+		case err == nil:
+			template.ID = existing.ID
+			template.CreatedAt = existing.CreatedAt
+			if err := tx.Where("template_row_id = ?", existing.ID).Delete(&TemplateVariant{}).Error; err != nil {
+				return err
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		for i := range template.Variants {
+			template.Variants[i].ID = 0
+		}
+		return tx.Save(template).Error
+	})
+}
+
+// DeleteTemplate removes a tenant's template and its variants. It returns the number of templates deleted.
+func DeleteTemplate(db *gorm.DB, tenantID, templateID string) (int64, error) {
+	var template Template
+	if err := db.Where("tenant_id = ? AND template_id = ?", tenantID, templateID).First(&template).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var deleted int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("template_row_id = ?", template.ID).Delete(&TemplateVariant{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&template)
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted, err
+}
+
+// ListTemplates returns a tenant's templates with their variants, ordered by template ID
+func ListTemplates(db *gorm.DB, tenantID string) ([]Template, error) {
+	var templates []Template
+	err := db.Preload("Variants").Where("tenant_id = ?", tenantID).Order("template_id").Find(&templates).Error
+	return templates, err
+}
@@ -15,6 +15,20 @@ type Tenant struct {
 	Active      bool      `gorm:"default:true" json:"active"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Quiet hours ("HH:MM" local time, may wrap midnight) held back for respect_quiet_hours sends
+	QuietHoursStart string `gorm:"type:varchar(5)" json:"quiet_hours_start,omitempty"`
+	QuietHoursEnd   string `gorm:"type:varchar(5)" json:"quiet_hours_end,omitempty"`
+	// DefaultTimezone is the IANA timezone used for devices that did not report one
+	DefaultTimezone string `gorm:"type:varchar(64)" json:"default_timezone,omitempty"`
+
+	// Request rate limit (token bucket) and push quotas; zero means unlimited. The rate limit and
+	// burst apply per Signal instance, since each keeps its buckets in memory: N instances admit
+	// up to N times the rate. Quotas are counted in the database and shared by all instances.
+	RateLimitPerSecond float64 `gorm:"not null;default:0" json:"rate_limit_per_second"`
+	RateLimitBurst     int     `gorm:"not null;default:0" json:"rate_limit_burst"`
+	DailyPushQuota     int64   `gorm:"not null;default:0" json:"daily_push_quota"`
+	MonthlyPushQuota   int64   `gorm:"not null;default:0" json:"monthly_push_quota"`
 }
 
 // CreateTenantIfNotExists creates a tenant if it doesn't exist
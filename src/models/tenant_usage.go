@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TenantUsage counts the push deliveries queued by a tenant in a daily or monthly period
+type TenantUsage struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID   string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_tenant_usage_period,priority:1" json:"tenant_id"`
+	Period     string    `gorm:"type:varchar(10);not null;uniqueIndex:idx_tenant_usage_period,priority:2" json:"period"` // "2006-01-02" or "2006-01"
+	Deliveries int64     `gorm:"not null;default:0" json:"deliveries"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// DailyPeriod returns the usage period key for the UTC day of t
+func DailyPeriod(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// MonthlyPeriod returns the usage period key for the UTC month of t
+func MonthlyPeriod(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// NextDailyPeriod returns the start of the UTC day after t, when its daily usage resets
+func NextDailyPeriod(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+// NextMonthlyPeriod returns the start of the UTC month after t, when its monthly usage resets
+func NextMonthlyPeriod(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// IncrementTenantUsage adds count deliveries to the tenant's daily and monthly usage
+func IncrementTenantUsage(db *gorm.DB, tenantID string, count int64, at time.Time) error {
+	for _, period := range []string{DailyPeriod(at), MonthlyPeriod(at)} {
+		usage := TenantUsage{TenantID: tenantID, Period: period, Deliveries: count}
+		if err := db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "tenant_id"}, {Name: "period"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"deliveries": gorm.Expr("deliveries + ?", count),
+				"updated_at": time.Now(),
+			}),
+		}).Create(&usage).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTenantUsage returns the tenant's usage for a period, or zero if nothing was recorded
+func GetTenantUsage(db *gorm.DB, tenantID, period string) (int64, error) {
+	var usage TenantUsage
+	err := db.Where("tenant_id = ? AND period = ?", tenantID, period).Limit(1).Find(&usage).Error
+	return usage.Deliveries, err
+}
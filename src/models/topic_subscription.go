@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// TopicSubscription records that a device is subscribed to an FCM topic, so the subscription
+// can be restored when the device's token is refreshed
+type TopicSubscription struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID    string    `gorm:"type:varchar(255);not null;index" json:"tenant_id"`
+	DeviceID    uint      `gorm:"not null;uniqueIndex:idx_topic_subscription_device_topic,priority:1" json:"device_id"`
+	Topic       string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_topic_subscription_device_topic,priority:2;index" json:"topic"`
+	DeviceToken string    `gorm:"type:varchar(500);not null" json:"device_token"` // token the subscription was made with
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,211 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErasureAudit records the erasure of a user's data. The user ID itself is not kept: the hash
+// proves that a given user was erased without retaining the identifier.
+type ErasureAudit struct {
+	ID                        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID                  string    `gorm:"type:varchar(255);not null;index:idx_erasure_audits_tenant_user,priority:1" json:"tenant_id"`
+	UserIDHash                string    `gorm:"type:varchar(64);not null;index:idx_erasure_audits_tenant_user,priority:2" json:"user_id_hash"` // SHA-256 of the user ID
+	DevicesDeleted            int64     `json:"devices_deleted"`
+	NotificationsDeleted      int64     `json:"notifications_deleted"`
+	DeliveriesDeleted         int64     `json:"deliveries_deleted"`
+	PushJobsDeleted           int64     `json:"push_jobs_deleted"`
+	DeadLettersDeleted        int64     `json:"dead_letters_deleted"`
+	LiveActivityTokensDeleted int64     `json:"live_activity_tokens_deleted"`
+	CreatedAt                 time.Time `json:"created_at"`
+}
+
+// ExportedDevice is a device registration in a user data export
+type ExportedDevice struct {
+	DeviceToken
+	Attributes         map[string]string   `json:"attributes"`
+	Tags               []string            `json:"tags"`
+	TopicSubscriptions []TopicSubscription `json:"topic_subscriptions"`
+}
+
+// ExportedPushJob is a queued push to one of the user's devices in a user data export, with the
+// message it will deliver
+type ExportedPushJob struct {
+	PushJob
+	Message json.RawMessage `json:"message"` // the job payload, rendered for the device
+}
+
+// UserExport is everything stored about one user of a tenant
+type UserExport struct {
+	TenantID           string              `json:"tenant_id"`
+	UserID             string              `json:"user_id"`
+	ExportedAt         time.Time           `json:"exported_at"`
+	Devices            []ExportedDevice    `json:"devices"`
+	LiveActivityTokens []LiveActivityToken `json:"live_activity_tokens"`
+	Notifications      []Notification      `json:"notifications"` // sent to the user or one of their devices, with deliveries
+	Deliveries         []Delivery          `json:"deliveries"`    // every delivery to the user's devices
+	PendingPushJobs    []ExportedPushJob   `json:"pending_push_jobs"`
+	DeadLetters        []DeadLetter        `json:"dead_letters"`
+}
+
+// HashUserID returns the SHA-256 hex digest of a user ID, as recorded in erasure audits
+func HashUserID(userID string) string {
+	sum := sha256.Sum256([]byte(userID))
+	return hex.EncodeToString(sum[:])
+}
+
+// userNotifications scopes a query to the notifications addressed to a user directly or to one
+// of their devices. A device-targeted send is the user's when it was made for them, including a
+// scheduled one not dispatched yet, when it was delivered to them, or when its token is currently
+// registered to them. Tenant-wide, topic and segment sends are never matched.
+func userNotifications(db *gorm.DB, tenantID, userID string) *gorm.DB {
+	return db.Where("tenant_id = ?", tenantID).
+		Where(db.Where("target_type = ? AND target = ?", TargetUser, userID).
+			Or("target_type = ? AND user_id = ?", TargetDevice, userID).
+			Or("target_type = ? AND id IN (?)", TargetDevice, db.Model(&Delivery{}).
+				Select("notification_id").
+				Where("tenant_id = ? AND user_id = ?", tenantID, userID)).
+			Or("target_type = ? AND target IN (?)", TargetDevice, db.Model(&DeviceToken{}).
+				Select("device_token").
+				Where("tenant_id = ? AND user_id = ?", tenantID, userID)))
+}
+
+// ExportUserData collects everything stored about a user of a tenant
+func ExportUserData(db *gorm.DB, tenantID, userID string) (*UserExport, error) {
+	export := &UserExport{
+		TenantID:           tenantID,
+		UserID:             userID,
+		ExportedAt:         time.Now().UTC(),
+		Devices:            []ExportedDevice{},
+		LiveActivityTokens: []LiveActivityToken{},
+		Notifications:      []Notification{},
+		Deliveries:         []Delivery{},
+		PendingPushJobs:    []ExportedPushJob{},
+		DeadLetters:        []DeadLetter{},
+	}
+
+	var devices []DeviceToken
+	if err := db.Where("tenant_id = ? AND user_id = ?", tenantID, userID).Order("id").Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		attributes, tags, err := GetDeviceAttributes(db, device.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		subscriptions := []TopicSubscription{}
+		if err := db.Where("tenant_id = ? AND device_id = ?", tenantID, device.ID).Order("id").Find(&subscriptions).Error; err != nil {
+			return nil, err
+		}
+
+		export.Devices = append(export.Devices, ExportedDevice{
+			DeviceToken:        device,
+			Attributes:         attributes,
+			Tags:               tags,
+			TopicSubscriptions: subscriptions,
+		})
+	}
+
+	if err := db.Where("tenant_id = ? AND user_id = ?", tenantID, userID).Order("id").Find(&export.LiveActivityTokens).Error; err != nil {
+		return nil, err
+	}
+	if err := userNotifications(db, tenantID, userID).Order("created_at").Find(&export.Notifications).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("tenant_id = ? AND user_id = ?", tenantID, userID).Order("id").Find(&export.Deliveries).Error; err != nil {
+		return nil, err
+	}
+
+	// Jobs not yet delivered hold the rendered message the user is about to receive. Completed
+	// jobs are left out: their outcome is in the deliveries, and failed ones in the dead letters.
+	var jobs []PushJob
+	if err := db.Where("tenant_id = ? AND user_id = ? AND status IN ?", tenantID, userID,
+		[]string{JobStatusPending, JobStatusProcessing}).Order("id").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		export.PendingPushJobs = append(export.PendingPushJobs, ExportedPushJob{PushJob: job, Message: json.RawMessage(job.Payload)})
+	}
+
+	if err := db.Where("tenant_id = ? AND user_id = ?", tenantID, userID).Order("id").Find(&export.DeadLetters).Error; err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// EraseUserData deletes everything stored about a user of a tenant and records an erasure audit.
+// Notifications addressed to the user or their devices are deleted with all their deliveries and
+// queued jobs; from other notifications, e.g. tenant-wide sends, only the user's deliveries are.
+func EraseUserData(db *gorm.DB, tenantID, userID string) (*ErasureAudit, error) {
+	audit := &ErasureAudit{TenantID: tenantID, UserIDHash: HashUserID(userID)}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Notifications are matched through the user's device tokens, so collect them first
+		var notificationIDs []string
+		if err := userNotifications(tx, tenantID, userID).Model(&Notification{}).Pluck("id", &notificationIDs).Error; err != nil {
+			return err
+		}
+
+		jobs := tx.Where("tenant_id = ? AND user_id = ?", tenantID, userID)
+		deliveries := tx.Where("tenant_id = ? AND user_id = ?", tenantID, userID)
+		deadLetters := tx.Where("tenant_id = ? AND user_id = ?", tenantID, userID)
+		if len(notificationIDs) > 0 {
+			jobs = jobs.Or("tenant_id = ? AND notification_id IN ?", tenantID, notificationIDs)
+			deliveries = deliveries.Or("tenant_id = ? AND notification_id IN ?", tenantID, notificationIDs)
+			deadLetters = deadLetters.Or("tenant_id = ? AND notification_id IN ?", tenantID, notificationIDs)
+		}
+
+		result := jobs.Delete(&PushJob{})
+		if result.Error != nil {
+			return result.Error
+		}
+		audit.PushJobsDeleted = result.RowsAffected
+
+		result = deliveries.Delete(&Delivery{})
+		if result.Error != nil {
+			return result.Error
+		}
+		audit.DeliveriesDeleted = result.RowsAffected
+
+		result = deadLetters.Delete(&DeadLetter{})
+		if result.Error != nil {
+			return result.Error
+		}
+		audit.DeadLettersDeleted = result.RowsAffected
+
+		if len(notificationIDs) > 0 {
+			result = tx.Where("tenant_id = ? AND id IN ?", tenantID, notificationIDs).Delete(&Notification{})
+			if result.Error != nil {
+				return result.Error
+			}
+			audit.NotificationsDeleted = result.RowsAffected
+		}
+
+		result = tx.Where("tenant_id = ? AND user_id = ?", tenantID, userID).Delete(&LiveActivityToken{})
+		if result.Error != nil {
+			return result.Error
+		}
+		audit.LiveActivityTokensDeleted = result.RowsAffected
+
+		var deviceIDs []uint
+		if err := tx.Model(&DeviceToken{}).Where("tenant_id = ? AND user_id = ?", tenantID, userID).Pluck("id", &deviceIDs).Error; err != nil {
+			return err
+		}
+		if err := DeleteDevices(tx, tenantID, deviceIDs); err != nil {
+			return err
+		}
+		audit.DevicesDeleted = int64(len(deviceIDs))
+
+		return tx.Create(audit).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return audit, nil
+}
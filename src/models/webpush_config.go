@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// WebPushConfig represents Web Push (VAPID) configuration for tenants. The VAPID private key
+// is stored in S3; the public key handed to browsers is derived from it.
+type WebPushConfig struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID  string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"tenant_id"`
+	Subject   string    `gorm:"type:varchar(255);not null" json:"subject"` // "mailto:" or "https:" contact sent to push services
+	Active    bool      `gorm:"default:true" json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
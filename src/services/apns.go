@@ -2,10 +2,13 @@ package services
 
 import (
 	"crypto/ecdsa"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
@@ -41,6 +44,11 @@ func NewAPNSService(s3Service *storage.S3Service, db *gorm.DB) *APNSService {
 	}
 }
 
+// Name returns the provider identifier
+func (s *APNSService) Name() string {
+	return "apns"
+}
+
 // getOrCreateClient gets or creates an APNS client for a tenant
 func (s *APNSService) getOrCreateClient(tenantID string) (*APNSClient, error) {
 	s.mu.RLock()
@@ -80,7 +88,7 @@ func (s *APNSService) getOrCreateClient(tenantID string) (*APNSClient, error) {
 
 	// Create APNS client
 	client := apns2.NewTokenClient(tokenSource)
-	if config.Environment == "sandbox" {
+	if config.Environment == models.APNSEnvironmentSandbox {
 		client = client.Development()
 	} else {
 		client = client.Production()
@@ -106,45 +114,133 @@ func (s *APNSService) getOrCreateClient(tenantID string) (*APNSClient, error) {
 }
 
 // SendPush sends a push notification via APNS
-func (s *APNSService) SendPush(tenantID, deviceToken, title, body string, data map[string]interface{}) error {
+func (s *APNSService) SendPush(tenantID, deviceToken string, msg *Message) (string, error) {
 	client, err := s.getOrCreateClient(tenantID)
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	notification, err := buildAPNSNotification(client, deviceToken, msg)
+	if err != nil {
+		return "", &PushError{Provider: s.Name(), Reason: err.Error(), Err: err}
+	}
+
+	// Send the notification
+	res, err := client.clientFor(msg.APNSEnvironment).Push(notification)
+	if err != nil {
+		return "", &PushError{Provider: s.Name(), Reason: err.Error(), Retryable: isNetworkTimeout(err), Err: err}
+	}
+
+	if !res.Sent() {
+		return "", &PushError{
+			Provider:   s.Name(),
+			StatusCode: res.StatusCode,
+			Reason:     res.Reason,
+			Retryable:  isRetryableAPNSStatus(res.StatusCode),
+
+			TokenInvalid: isInvalidAPNSToken(res),
+		}
+	}
+
+	log.Printf("✅ APNS push sent successfully to %s via tenant %s (apns-id: %s)", deviceToken, tenantID, res.ApnsID)
+	return res.ApnsID, nil
+}
+
+// DryRun builds the APNS request for a device token without sending it
+func (s *APNSService) DryRun(tenantID, deviceToken string, msg *Message) (*PushPreview, error) {
+	client, err := s.getOrCreateClient(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	notification, err := buildAPNSNotification(client, deviceToken, msg)
+	if err != nil {
+		return nil, &PushError{Provider: s.Name(), Reason: err.Error(), Err: err}
+	}
+
+	body, err := json.Marshal(notification.Payload)
+	if err != nil {
+		return nil, &PushError{Provider: s.Name(), Reason: err.Error(), Err: err}
+	}
+
+	headers := map[string]string{
+		"apns-topic":     notification.Topic,
+		"apns-push-type": string(notification.PushType),
+	}
+	if notification.Priority != 0 {
+		headers["apns-priority"] = strconv.Itoa(notification.Priority)
+	}
+	if !notification.Expiration.IsZero() {
+		headers["apns-expiration"] = strconv.FormatInt(notification.Expiration.Unix(), 10)
+	}
+	if notification.CollapseID != "" {
+		headers["apns-collapse-id"] = notification.CollapseID
+	}
+
+	return &PushPreview{Headers: headers, Payload: json.RawMessage(body)}, nil
+}
+
+// buildAPNSNotification builds the APNS request for a message: the payload, fitted into the
+// APNS size limit, the headers and the topic, which Live Activity pushes suffix
+func buildAPNSNotification(client *APNSClient, deviceToken string, msg *Message) (*apns2.Notification, error) {
+	msg, err := fitAPNSMessage(msg)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create the notification
 	notification := &apns2.Notification{
 		DeviceToken: deviceToken,
 		Topic:       client.Config.BundleID,
-		Payload: []byte(fmt.Sprintf(`{
-			"aps": {
-				"alert": {
-					"title": "%s",
-					"body": "%s"
-				},
-				"sound": "default"
-			}
-		}`, title, body)),
+		Payload:     buildAPNSPayload(msg),
 	}
 
-	// Add custom data if provided
-	if len(data) > 0 {
-		// TODO: Properly merge custom data into payload JSON
-		log.Printf("Custom data provided but not yet implemented: %+v", data)
+	applyAPNSHeaders(notification, msg)
+	if msg.LiveActivity != nil {
+		notification.Topic += liveActivityTopicSuffix
 	}
+	return notification, nil
+}
 
-	// Send the notification
-	res, err := client.Client.Push(notification)
-	if err != nil {
-		return fmt.Errorf("failed to send APNS push: %w", err)
+// clientFor returns the client for the APNS environment a device token belongs to. Devices
+// registered with an environment hint are sent to that environment's host with the tenant's
+// credentials, which are valid for both; others follow the tenant configuration.
+func (c *APNSClient) clientFor(environment string) *apns2.Client {
+	var host string
+	switch environment {
+	case models.APNSEnvironmentSandbox:
+		host = apns2.HostDevelopment
+	case models.APNSEnvironmentProduction:
+		host = apns2.HostProduction
+	default:
+		return c.Client
 	}
 
-	if !res.Sent() {
-		return fmt.Errorf("APNS push failed: %s (reason: %s)", res.StatusCode, res.Reason)
+	if c.Client.Host == host {
+		return c.Client
 	}
+	client := *c.Client
+	client.Host = host
+	return &client
+}
 
-	log.Printf("✅ APNS push sent successfully to %s via tenant %s", deviceToken, tenantID)
-	return nil
+// isRetryableAPNSStatus reports whether an APNS status code is transient
+func isRetryableAPNSStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// isInvalidAPNSToken reports whether APNS rejected the device token itself
+func isInvalidAPNSToken(res *apns2.Response) bool {
+	switch {
+	case res.StatusCode == http.StatusGone && res.Reason == apns2.ReasonUnregistered:
+		return true
+	case res.StatusCode == http.StatusBadRequest && res.Reason == apns2.ReasonBadDeviceToken:
+		return true
+	}
+	return false
 }
 
 // CleanupOldClients removes unused clients from cache
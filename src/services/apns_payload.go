@@ -0,0 +1,227 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sideshow/apns2"
+	"github.com/sideshow/apns2/payload"
+)
+
+// maxAPNSCollapseIDLen is the largest apns-collapse-id APNS accepts, in bytes
+const maxAPNSCollapseIDLen = 64
+
+// apnsPushTypes lists the apns-push-type values that can be requested
+var apnsPushTypes = map[apns2.EPushType]bool{
+	apns2.PushTypeAlert:        true,
+	apns2.PushTypeBackground:   true,
+	apns2.PushTypeLocation:     true,
+	apns2.PushTypeVOIP:         true,
+	apns2.PushTypeComplication: true,
+	apns2.PushTypeFileProvider: true,
+	apns2.PushTypeMDM:          true,
+	apns2.PushTypePushToTalk:   true,
+}
+
+// APNSSound is either a sound file name or a critical alert sound dictionary. In JSON it is
+// written as a plain string ("default") or as {"name": "alarm.caf", "critical": true, "volume": 0.8}.
+type APNSSound struct {
+	Name     string  `json:"name,omitempty"`
+	Critical bool    `json:"critical,omitempty"`
+	Volume   float32 `json:"volume,omitempty"` // 0.0 - 1.0, critical alerts only
+}
+
+// UnmarshalJSON accepts both the string and the dictionary form
+func (s *APNSSound) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*s = APNSSound{Name: name}
+		return nil
+	}
+
+	type sound APNSSound
+	var dict sound
+	if err := json.Unmarshal(data, &dict); err != nil {
+		return fmt.Errorf("sound must be a string or a dictionary: %w", err)
+	}
+	*s = APNSSound(dict)
+	return nil
+}
+
+// MarshalJSON writes plain sounds as a string so stored payloads mirror the request
+func (s APNSSound) MarshalJSON() ([]byte, error) {
+	if !s.Critical {
+		return json.Marshal(s.Name)
+	}
+
+	type sound APNSSound
+	return json.Marshal(sound(s))
+}
+
+// APNSOptions holds the iOS-specific fields of a push, mapped onto the aps dictionary
+type APNSOptions struct {
+	Badge            *int       `json:"badge,omitempty"` // 0 clears the badge
+	Sound            *APNSSound `json:"sound,omitempty"` // defaults to "default" for alert pushes
+	Category         string     `json:"category,omitempty"`
+	ThreadID         string     `json:"thread_id,omitempty"`
+	Subtitle         string     `json:"subtitle,omitempty"`
+	MutableContent   bool       `json:"mutable_content,omitempty"`
+	ContentAvailable bool       `json:"content_available,omitempty"`
+
+	// Request headers
+	PushType   apns2.EPushType `json:"push_type,omitempty"`  // inferred from the payload when empty
+	Priority   int             `json:"priority,omitempty"`   // 5 or 10; inferred from the push type when empty
+	Expiration *time.Time      `json:"expiration,omitempty"` // RFC3339; APNS stops retrying after this time
+	CollapseID string          `json:"collapse_id,omitempty"`
+}
+
+// Validate checks the options for values APNS would reject
+func (o *APNSOptions) Validate() error {
+	if o.Badge != nil && *o.Badge < 0 {
+		return fmt.Errorf("badge must not be negative")
+	}
+
+	if o.Sound != nil {
+		if o.Sound.Name == "" && !o.Sound.Critical {
+			return fmt.Errorf("sound name is required")
+		}
+		if o.Sound.Volume < 0 || o.Sound.Volume > 1 {
+			return fmt.Errorf("sound volume must be between 0 and 1")
+		}
+	}
+
+	if o.PushType != "" && !apnsPushTypes[o.PushType] {
+		return fmt.Errorf("unsupported push_type %q", o.PushType)
+	}
+
+	if o.Priority != 0 && o.Priority != apns2.PriorityLow && o.Priority != apns2.PriorityHigh {
+		return fmt.Errorf("priority must be %d or %d", apns2.PriorityLow, apns2.PriorityHigh)
+	}
+
+	if o.PushType == apns2.PushTypeBackground {
+		if !o.ContentAvailable {
+			return fmt.Errorf("background pushes require content_available")
+		}
+		if o.Priority == apns2.PriorityHigh {
+			return fmt.Errorf("background pushes must use priority %d", apns2.PriorityLow)
+		}
+	}
+
+	if o.Expiration != nil && !o.Expiration.After(time.Now()) {
+		return fmt.Errorf("expiration must be in the future")
+	}
+
+	if len(o.CollapseID) > maxAPNSCollapseIDLen {
+		return fmt.Errorf("collapse_id must be at most %d bytes", maxAPNSCollapseIDLen)
+	}
+
+	return nil
+}
+
+// isBackgroundAPNSPush reports whether the push is a silent content-available push with no alert
+func isBackgroundAPNSPush(msg *Message) bool {
+	return msg.APNS != nil && msg.APNS.ContentAvailable && msg.Title == "" && msg.Body == "" && msg.APNS.Subtitle == ""
+}
+
+// applyAPNSHeaders sets the apns-push-type, apns-priority, apns-expiration and apns-collapse-id
+// headers of a notification. Push type and priority are inferred when not requested: silent
+// pushes are sent as background pushes with priority 5, everything else as alerts.
+func applyAPNSHeaders(notification *apns2.Notification, msg *Message) {
+	options := msg.APNS
+	if options == nil {
+		options = &APNSOptions{}
+	}
+
+	notification.PushType = options.PushType
+	switch {
+	case msg.LiveActivity != nil:
+		notification.PushType = apns2.PushTypeLiveActivity
+	case notification.PushType == "" && isBackgroundAPNSPush(msg):
+		notification.PushType = apns2.PushTypeBackground
+	case notification.PushType == "":
+		notification.PushType = apns2.PushTypeAlert
+	}
+
+	notification.Priority = options.Priority
+	if notification.Priority == 0 && notification.PushType == apns2.PushTypeBackground {
+		notification.Priority = apns2.PriorityLow
+	}
+
+	if options.Expiration != nil {
+		notification.Expiration = *options.Expiration
+	}
+	notification.CollapseID = options.CollapseID
+}
+
+// buildAPNSPayload builds the APNS JSON payload for a message. Custom data keys are merged
+// at the top level, next to aps. Live Activity messages get their own aps layout.
+func buildAPNSPayload(msg *Message) *payload.Payload {
+	if msg.LiveActivity != nil {
+		return buildLiveActivityPayload(msg)
+	}
+
+	p := payload.NewPayload()
+	options := msg.APNS
+	if options == nil {
+		options = &APNSOptions{}
+	}
+
+	if msg.Title != "" {
+		p.AlertTitle(msg.Title)
+	}
+	if msg.Body != "" {
+		p.AlertBody(msg.Body)
+	}
+	if options.Subtitle != "" {
+		p.AlertSubtitle(options.Subtitle)
+	}
+
+	if options.Badge != nil {
+		if *options.Badge == 0 {
+			p.ZeroBadge()
+		} else {
+			p.Badge(*options.Badge)
+		}
+	}
+
+	switch {
+	case options.Sound != nil && options.Sound.Critical:
+		name := options.Sound.Name
+		if name == "" {
+			name = "default"
+		}
+		volume := options.Sound.Volume
+		if volume == 0 {
+			volume = 1.0
+		}
+		p.SoundName(name).SoundVolume(volume)
+	case options.Sound != nil:
+		p.Sound(options.Sound.Name)
+	case !isBackgroundAPNSPush(msg):
+		p.Sound("default")
+	}
+
+	if options.Category != "" {
+		p.Category(options.Category)
+	}
+	if options.ThreadID != "" {
+		p.ThreadID(options.ThreadID)
+	}
+	if options.MutableContent {
+		p.MutableContent()
+	}
+	if options.ContentAvailable {
+		p.ContentAvailable()
+	}
+
+	for key, value := range msg.Data {
+		// aps is reserved for Apple; handlers reject it, but never let it overwrite the payload
+		if key == "aps" {
+			continue
+		}
+		p.Custom(key, value)
+	}
+
+	return p
+}
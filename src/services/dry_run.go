@@ -0,0 +1,75 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gaulatti/signal/src/models"
+)
+
+// maxDryRunDevices bounds how many devices a dry run builds previews for. FCM validates each
+// preview with a request, so large audiences are sampled rather than previewed in full.
+const maxDryRunDevices = 100
+
+// DryRunResult is the outcome of a dry run for one device
+type DryRunResult struct {
+	DeviceID    uint         `json:"device_id,omitempty"`
+	UserID      string       `json:"user_id,omitempty"`
+	Platform    string       `json:"platform"`
+	Provider    string       `json:"provider,omitempty"`
+	DeviceToken string       `json:"device_token"`
+	Preview     *PushPreview `json:"preview,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// DryRun runs a message through the delivery pipeline for up to maxDryRunDevices devices without
+// recording or sending anything: templates are rendered per device, and each provider builds and
+// validates its request. Per-device failures are reported in the results.
+func (q *Queue) DryRun(tenantID string, devices []models.DeviceToken, msg *Message) ([]DryRunResult, error) {
+	devices = devices[:min(len(devices), maxDryRunDevices)]
+
+	payloads, err := renderPayloads(q.db, tenantID, msg, devices)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]DryRunResult, len(devices))
+	for i := range devices {
+		device := &devices[i]
+		result := &results[i]
+		result.DeviceID = device.ID
+		result.UserID = device.UserID
+		result.Platform = device.Platform
+		result.DeviceToken = device.DeviceToken
+
+		provider, exists := q.registry.Get(device.Platform)
+		if !exists {
+			result.Error = fmt.Sprintf("unsupported platform: %s", device.Platform)
+			continue
+		}
+		result.Provider = provider.Name()
+
+		dryRunner, ok := provider.(DryRunProvider)
+		if !ok {
+			result.Error = fmt.Sprintf("%s does not support dry runs", provider.Name())
+			continue
+		}
+
+		// Decode the rendered payload like a worker would, so previews match real deliveries
+		var rendered Message
+		if err := json.Unmarshal([]byte(payloads[i]), &rendered); err != nil {
+			result.Error = fmt.Sprintf("invalid payload: %v", err)
+			continue
+		}
+		rendered.APNSEnvironment = device.Environment
+
+		preview, err := dryRunner.DryRun(tenantID, device.DeviceToken, &rendered)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		result.Preview = preview
+	}
+
+	return results, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -39,6 +40,11 @@ func NewFCMService(s3Service *storage.S3Service, db *gorm.DB) *FCMService {
 	}
 }
 
+// Name returns the provider identifier
+func (s *FCMService) Name() string {
+	return "fcm"
+}
+
 // getOrCreateClient gets or creates an FCM client for a tenant
 func (s *FCMService) getOrCreateClient(tenantID string) (*FCMClient, error) {
 	s.mu.RLock()
@@ -92,51 +98,205 @@ func (s *FCMService) getOrCreateClient(tenantID string) (*FCMClient, error) {
 }
 
 // SendPush sends a push notification via FCM
-func (s *FCMService) SendPush(tenantID, deviceToken, title, body string, data map[string]interface{}) error {
+func (s *FCMService) SendPush(tenantID, deviceToken string, msg *Message) (string, error) {
 	client, err := s.getOrCreateClient(tenantID)
 	if err != nil {
-		return err
-	}
-
-	// Convert data map to string map (FCM requirement)
-	stringData := make(map[string]string)
-	for k, v := range data {
-		stringData[k] = fmt.Sprintf("%v", v)
-	}
-
-	// Create the message
-	message := &messaging.Message{
-		Token: deviceToken,
-		Notification: &messaging.Notification{
-			Title: title,
-			Body:  body,
-		},
-		Data: stringData,
-		Android: &messaging.AndroidConfig{
-			Notification: &messaging.AndroidNotification{
-				Sound: "default",
-			},
-		},
-		APNS: &messaging.APNSConfig{
-			Payload: &messaging.APNSPayload{
-				Aps: &messaging.Aps{
-					Sound: "default",
-				},
-			},
-		},
+		return "", err
+	}
+
+	message, err := buildFittedFCMMessage(msg)
+	if err != nil {
+		return "", &PushError{Provider: s.Name(), Reason: err.Error(), Err: err}
 	}
 
+	setFCMRecipient(message, deviceToken, msg)
+
 	// Send the message
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	response, err := client.Client.Send(ctx, message)
 	if err != nil {
-		return fmt.Errorf("failed to send FCM push: %w", err)
+		pushErr := classifyFCMError(s.Name(), err)
+		if message.Token == "" {
+			pushErr.TokenInvalid = false
+		}
+		return "", pushErr
 	}
 
 	log.Printf("✅ FCM push sent successfully to %s via tenant %s (response: %s)", deviceToken, tenantID, response)
-	return nil
+	return response, nil
+}
+
+// DryRun validates the message for a device token with FCM without delivering it
+func (s *FCMService) DryRun(tenantID, deviceToken string, msg *Message) (*PushPreview, error) {
+	client, err := s.getOrCreateClient(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := buildFittedFCMMessage(msg)
+	if err != nil {
+		return nil, &PushError{Provider: s.Name(), Reason: err.Error(), Err: err}
+	}
+	setFCMRecipient(message, deviceToken, msg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	response, err := client.Client.SendDryRun(ctx, message)
+	if err != nil {
+		return nil, classifyFCMError(s.Name(), err)
+	}
+
+	return &PushPreview{Payload: message, MessageID: response}, nil
+}
+
+// setFCMRecipient addresses a message to its topic or condition, or else to the device token
+func setFCMRecipient(message *messaging.Message, deviceToken string, msg *Message) {
+	switch {
+	case msg.Topic != "":
+		message.Topic = msg.Topic
+	case msg.Condition != "":
+		message.Condition = msg.Condition
+	default:
+		message.Token = deviceToken
+	}
+}
+
+// fcmMulticastLimit is the largest number of tokens FCM accepts in one multicast request
+const fcmMulticastLimit = 500
+
+// MaxBatchSize returns the FCM multicast token limit
+func (s *FCMService) MaxBatchSize() int {
+	return fcmMulticastLimit
+}
+
+// SendBatch sends a message to up to 500 device tokens with a single multicast request and maps
+// every per-token response back to its token
+func (s *FCMService) SendBatch(tenantID string, deviceTokens []string, msg *Message) ([]BatchResult, error) {
+	if len(deviceTokens) > fcmMulticastLimit {
+		return nil, fmt.Errorf("FCM multicast accepts at most %d tokens, got %d", fcmMulticastLimit, len(deviceTokens))
+	}
+
+	client, err := s.getOrCreateClient(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := buildFittedFCMMessage(msg)
+	if err != nil {
+		return nil, &PushError{Provider: s.Name(), Reason: err.Error(), Err: err}
+	}
+
+	multicast := &messaging.MulticastMessage{
+		Tokens:       deviceTokens,
+		Data:         message.Data,
+		Notification: message.Notification,
+		Android:      message.Android,
+		Webpush:      message.Webpush,
+		APNS:         message.APNS,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	response, err := client.Client.SendEachForMulticast(ctx, multicast)
+	if err != nil {
+		// A failed request says nothing about the individual tokens, so never prune them for it
+		pushErr := classifyFCMError(s.Name(), err)
+		pushErr.TokenInvalid = false
+		return nil, pushErr
+	}
+
+	results := make([]BatchResult, len(deviceTokens))
+	for i, res := range response.Responses {
+		if res.Success {
+			results[i].MessageID = res.MessageID
+		} else {
+			results[i].Err = classifyFCMError(s.Name(), res.Error)
+		}
+	}
+
+	log.Printf("✅ FCM multicast sent via tenant %s: %d succeeded, %d failed", tenantID, response.SuccessCount, response.FailureCount)
+	return results, nil
+}
+
+// fcmTopicManagementLimit is the largest number of tokens FCM accepts per topic management request
+const fcmTopicManagementLimit = 1000
+
+// SubscribeToTopic subscribes device tokens to an FCM topic. It returns the failure reason of
+// every token that could not be subscribed, keyed by its index in deviceTokens.
+func (s *FCMService) SubscribeToTopic(tenantID string, deviceTokens []string, topic string) (map[int]string, error) {
+	return s.manageTopic(tenantID, deviceTokens, topic, true)
+}
+
+// UnsubscribeFromTopic unsubscribes device tokens from an FCM topic, returning per-token failures
+// like SubscribeToTopic
+func (s *FCMService) UnsubscribeFromTopic(tenantID string, deviceTokens []string, topic string) (map[int]string, error) {
+	return s.manageTopic(tenantID, deviceTokens, topic, false)
+}
+
+// manageTopic subscribes or unsubscribes tokens in chunks of the FCM request limit
+func (s *FCMService) manageTopic(tenantID string, deviceTokens []string, topic string, subscribe bool) (map[int]string, error) {
+	client, err := s.getOrCreateClient(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	failures := make(map[int]string)
+	for start := 0; start < len(deviceTokens); start += fcmTopicManagementLimit {
+		chunk := deviceTokens[start:min(start+fcmTopicManagementLimit, len(deviceTokens))]
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var response *messaging.TopicManagementResponse
+		if subscribe {
+			response, err = client.Client.SubscribeToTopic(ctx, chunk, topic)
+		} else {
+			response, err = client.Client.UnsubscribeFromTopic(ctx, chunk, topic)
+		}
+		cancel()
+
+		if err != nil {
+			return nil, fmt.Errorf("FCM topic request for %s failed: %w", topic, err)
+		}
+
+		for _, info := range response.Errors {
+			failures[start+info.Index] = info.Reason
+		}
+	}
+
+	return failures, nil
+}
+
+// classifyFCMError wraps an FCM send error, flagging transient failures and dead tokens
+func classifyFCMError(provider string, err error) *PushError {
+	retryable := messaging.IsUnavailable(err) ||
+		messaging.IsInternal(err) ||
+		messaging.IsQuotaExceeded(err) ||
+		isNetworkTimeout(err)
+
+	// INVALID_ARGUMENT usually describes the message, which fails the delivery permanently
+	// without pruning the device; only a malformed registration token prunes it
+	tokenInvalid := messaging.IsUnregistered(err) ||
+		messaging.IsSenderIDMismatch(err) ||
+		(messaging.IsInvalidArgument(err) && namesFCMToken(err.Error()))
+
+	return &PushError{
+		Provider:     provider,
+		Reason:       err.Error(),
+		Retryable:    retryable,
+		TokenInvalid: tokenInvalid,
+		Err:          err,
+	}
+}
+
+// namesFCMToken reports whether an FCM error message is about the registration token, e.g. "The
+// registration token is not a valid FCM registration token". FCM uses the same INVALID_ARGUMENT
+// code for message errors, and only the message or the offending field tells them apart.
+func namesFCMToken(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "registration token") || strings.Contains(message, "message.token")
 }
 
 // CleanupOldClients removes unused clients from cache
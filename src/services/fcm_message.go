@@ -0,0 +1,233 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/v4/messaging"
+)
+
+// maxFCMTTL is the longest time-to-live FCM accepts
+const maxFCMTTL = 28 * 24 * time.Hour
+
+// Android message priorities
+const (
+	FCMPriorityNormal = "normal"
+	FCMPriorityHigh   = "high"
+)
+
+// webpushUrgencies lists the values of the Web Push Urgency header
+var webpushUrgencies = map[string]bool{"very-low": true, "low": true, "normal": true, "high": true}
+
+// FCMWebpushOptions holds the fields mapped onto messaging.WebpushConfig for browser clients
+type FCMWebpushOptions struct {
+	Link    string `json:"link,omitempty"` // HTTPS URL opened when the notification is clicked
+	Icon    string `json:"icon,omitempty"`
+	Badge   string `json:"badge,omitempty"`
+	Urgency string `json:"urgency,omitempty"` // very-low, low, normal or high
+}
+
+// FCMOptions holds the FCM-specific fields of a push, mapped onto messaging.AndroidConfig and
+// messaging.WebpushConfig
+type FCMOptions struct {
+	DataOnly    bool               `json:"data_only,omitempty"` // send data without a notification block
+	Priority    string             `json:"priority,omitempty"`  // normal or high
+	TTL         *int64             `json:"ttl,omitempty"`       // seconds; 0 means deliver now or drop
+	ChannelID   string             `json:"channel_id,omitempty"`
+	Tag         string             `json:"tag,omitempty"`          // replaces a displayed notification with the same tag
+	CollapseKey string             `json:"collapse_key,omitempty"` // collapses undelivered messages with the same key
+	ImageURL    string             `json:"image,omitempty"`
+	ClickAction string             `json:"click_action,omitempty"`
+	Sound       string             `json:"sound,omitempty"` // defaults to "default" for notification messages
+	Webpush     *FCMWebpushOptions `json:"webpush,omitempty"`
+}
+
+// Validate checks the options for values FCM would reject
+func (o *FCMOptions) Validate() error {
+	if o.Priority != "" && o.Priority != FCMPriorityNormal && o.Priority != FCMPriorityHigh {
+		return fmt.Errorf("priority must be %s or %s", FCMPriorityNormal, FCMPriorityHigh)
+	}
+
+	if o.TTL != nil && (*o.TTL < 0 || time.Duration(*o.TTL)*time.Second > maxFCMTTL) {
+		return fmt.Errorf("ttl must be between 0 and %d seconds", int64(maxFCMTTL/time.Second))
+	}
+
+	if o.ImageURL != "" {
+		if err := validateHTTPSURL(o.ImageURL); err != nil {
+			return fmt.Errorf("image %w", err)
+		}
+	}
+
+	if o.DataOnly && (o.ChannelID != "" || o.Tag != "" || o.ImageURL != "" || o.ClickAction != "" || o.Sound != "") {
+		return fmt.Errorf("data_only messages cannot set notification fields")
+	}
+
+	if o.Webpush != nil {
+		if o.Webpush.Link != "" {
+			if err := validateHTTPSURL(o.Webpush.Link); err != nil {
+				return fmt.Errorf("webpush link %w", err)
+			}
+		}
+		if o.Webpush.Urgency != "" && !webpushUrgencies[o.Webpush.Urgency] {
+			return fmt.Errorf("webpush urgency must be one of very-low, low, normal, high")
+		}
+	}
+
+	return nil
+}
+
+// validateHTTPSURL checks that value is an absolute HTTPS URL
+func validateHTTPSURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("must be an absolute https URL")
+	}
+	return nil
+}
+
+// fcmReservedDataKeys are data keys FCM rejects with INVALID_ARGUMENT; so are keys starting with
+// "google" or "gcm"
+var fcmReservedDataKeys = map[string]bool{"from": true, "notification": true, "message_type": true}
+
+// ValidateFCMData checks custom data for keys FCM reserves. FCM rejects such a message as a whole,
+// so /push/fcm refuses it up front and every other FCM delivery fails without being sent. Other
+// providers accept these keys.
+func ValidateFCMData(data map[string]interface{}) error {
+	for key := range data {
+		lower := strings.ToLower(key)
+		if fcmReservedDataKeys[lower] || strings.HasPrefix(lower, "google") || strings.HasPrefix(lower, "gcm") {
+			return fmt.Errorf("data key %q is reserved by FCM", key)
+		}
+	}
+	return nil
+}
+
+// encodeFCMData converts custom data to the string map FCM requires. Strings are sent as-is and
+// every other value is JSON-encoded, so nested objects arrive as parseable JSON.
+func encodeFCMData(data map[string]interface{}) (map[string]string, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	encoded := make(map[string]string, len(data))
+	for key, value := range data {
+		if s, ok := value.(string); ok {
+			encoded[key] = s
+			continue
+		}
+
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("data key %q cannot be encoded: %w", key, err)
+		}
+		encoded[key] = string(raw)
+	}
+	return encoded, nil
+}
+
+// buildFCMMessage builds the FCM message for a message. The recipient (token, topic or
+// condition) is left for the caller to set.
+func buildFCMMessage(msg *Message) (*messaging.Message, error) {
+	options := msg.FCM
+	if options == nil {
+		options = &FCMOptions{}
+	}
+
+	data, err := encodeFCMData(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	message := &messaging.Message{
+		Data: data,
+		Android: &messaging.AndroidConfig{
+			CollapseKey: options.CollapseKey,
+			Priority:    options.Priority,
+		},
+	}
+
+	if options.TTL != nil {
+		ttl := time.Duration(*options.TTL) * time.Second
+		message.Android.TTL = &ttl
+	}
+
+	if options.DataOnly {
+		// iOS clients only receive data messages in the background when content-available is set
+		message.APNS = &messaging.APNSConfig{
+			Headers: map[string]string{"apns-priority": "5"},
+			Payload: &messaging.APNSPayload{Aps: &messaging.Aps{ContentAvailable: true}},
+		}
+	} else {
+		sound := options.Sound
+		if sound == "" {
+			sound = "default"
+		}
+
+		message.Notification = &messaging.Notification{
+			Title:    msg.Title,
+			Body:     msg.Body,
+			ImageURL: options.ImageURL,
+		}
+		message.Android.Notification = &messaging.AndroidNotification{
+			Sound:       sound,
+			ChannelID:   options.ChannelID,
+			Tag:         options.Tag,
+			ClickAction: options.ClickAction,
+		}
+		message.APNS = &messaging.APNSConfig{
+			Payload: &messaging.APNSPayload{
+				Aps: &messaging.Aps{
+					Sound: sound,
+				},
+			},
+		}
+	}
+
+	if options.Webpush != nil {
+		message.Webpush = buildFCMWebpushConfig(options)
+	}
+
+	return message, nil
+}
+
+// buildFittedFCMMessage builds the FCM message for a message fitted into the FCM size limit
+func buildFittedFCMMessage(msg *Message) (*messaging.Message, error) {
+	if err := ValidateFCMData(msg.Data); err != nil {
+		return nil, err
+	}
+
+	fitted, err := fitFCMMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	return buildFCMMessage(fitted)
+}
+
+// buildFCMWebpushConfig maps the web push options onto messaging.WebpushConfig
+func buildFCMWebpushConfig(options *FCMOptions) *messaging.WebpushConfig {
+	webpush := options.Webpush
+	config := &messaging.WebpushConfig{Headers: make(map[string]string)}
+
+	if webpush.Urgency != "" {
+		config.Headers["Urgency"] = webpush.Urgency
+	}
+	if options.TTL != nil {
+		config.Headers["TTL"] = strconv.FormatInt(*options.TTL, 10)
+	}
+	if webpush.Link != "" {
+		config.FCMOptions = &messaging.WebpushFCMOptions{Link: webpush.Link}
+	}
+	if !options.DataOnly && (webpush.Icon != "" || webpush.Badge != "" || options.Tag != "") {
+		config.Notification = &messaging.WebpushNotification{
+			Icon:  webpush.Icon,
+			Badge: webpush.Badge,
+			Tag:   options.Tag,
+		}
+	}
+
+	return config
+}
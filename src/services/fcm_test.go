@@ -0,0 +1,22 @@
+package services
+
+import "testing"
+
+func TestNamesFCMToken(t *testing.T) {
+	tests := []struct {
+		message string
+		want    bool
+	}{
+		{message: "The registration token is not a valid FCM registration token", want: true},
+		{message: "Invalid value at 'message.token' (TYPE_STRING)", want: true},
+		{message: "Request contains an invalid argument.", want: false},
+		{message: "Invalid JSON payload received. Unknown name \"badge\" at 'message.android.notification'", want: false},
+		{message: "Message.data must not contain reserved key \"from\"", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := namesFCMToken(tt.message); got != tt.want {
+			t.Errorf("namesFCMToken(%q) = %v, want %v", tt.message, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sideshow/apns2/payload"
+)
+
+// LiveActivityEventStart starts a new Live Activity with a push-to-start token; apns2 only
+// defines the update and end events.
+const LiveActivityEventStart payload.ELiveActivityEvent = "start"
+
+// liveActivityTopicSuffix is appended to the bundle ID to form the Live Activity APNS topic
+const liveActivityTopicSuffix = ".push-type.liveactivity"
+
+// LiveActivity is the content of a Live Activity push. A message carrying it is sent by APNS
+// with apns-push-type liveactivity instead of as a regular notification.
+type LiveActivity struct {
+	Event          payload.ELiveActivityEvent `json:"event"` // start, update or end
+	ContentState   map[string]interface{}     `json:"content_state,omitempty"`
+	Timestamp      int64                      `json:"timestamp"` // unix seconds; APNS drops updates older than the last one shown
+	StaleDate      *time.Time                 `json:"stale_date,omitempty"`
+	DismissalDate  *time.Time                 `json:"dismissal_date,omitempty"`  // end events only
+	AttributesType string                     `json:"attributes_type,omitempty"` // start events only
+	Attributes     map[string]interface{}     `json:"attributes,omitempty"`      // start events only
+}
+
+// Validate checks that the fields required by the event are present
+func (a *LiveActivity) Validate() error {
+	switch a.Event {
+	case LiveActivityEventStart:
+		if a.AttributesType == "" {
+			return fmt.Errorf("start events require attributes_type")
+		}
+	case payload.LiveActivityEventUpdate, payload.LiveActivityEventEnd:
+		if a.AttributesType != "" || len(a.Attributes) > 0 {
+			return fmt.Errorf("attributes_type and attributes are only allowed on start events")
+		}
+	default:
+		return fmt.Errorf("event must be one of start, update, end")
+	}
+
+	if a.Event != payload.LiveActivityEventEnd && len(a.ContentState) == 0 {
+		return fmt.Errorf("%s events require content_state", a.Event)
+	}
+
+	if a.DismissalDate != nil && a.Event != payload.LiveActivityEventEnd {
+		return fmt.Errorf("dismissal_date is only allowed on end events")
+	}
+
+	return nil
+}
+
+// buildLiveActivityPayload builds the aps dictionary of a Live Activity push. The alert is
+// optional and makes the device light up with the update.
+func buildLiveActivityPayload(msg *Message) *payload.Payload {
+	activity := msg.LiveActivity
+	p := payload.NewPayload().
+		SetEvent(activity.Event).
+		SetTimestamp(activity.Timestamp)
+
+	if len(activity.ContentState) > 0 {
+		p.SetContentState(activity.ContentState)
+	}
+	if activity.StaleDate != nil {
+		p.SetStaleDate(activity.StaleDate.Unix())
+	}
+	if activity.DismissalDate != nil {
+		p.SetDismissalDate(activity.DismissalDate.Unix())
+	}
+	if activity.Event == LiveActivityEventStart {
+		p.SetAttributesType(activity.AttributesType)
+		p.SetAttributes(activity.Attributes)
+	}
+
+	if msg.Title != "" {
+		p.AlertTitle(msg.Title)
+	}
+	if msg.Body != "" {
+		p.AlertBody(msg.Body)
+	}
+	if msg.Title != "" || msg.Body != "" {
+		p.Sound("default")
+	}
+
+	return p
+}
@@ -0,0 +1,34 @@
+package services
+
+// Message is the provider-agnostic content of a push notification
+type Message struct {
+	Title string                 `json:"title"`
+	Body  string                 `json:"body"`
+	Data  map[string]interface{} `json:"data,omitempty"`
+
+	// APNS carries iOS-specific options; other providers ignore it
+	APNS *APNSOptions `json:"apns,omitempty"`
+
+	// FCM carries Android and web options; other providers ignore it
+	FCM *FCMOptions `json:"fcm,omitempty"`
+
+	// WebPush carries browser push options for the web platform; other providers ignore it
+	WebPush *WebPushOptions `json:"webpush,omitempty"`
+
+	// Topic or Condition send the message to FCM topic subscribers instead of a device token
+	Topic     string `json:"topic,omitempty"`
+	Condition string `json:"condition,omitempty"`
+
+	// LiveActivity turns the message into an iOS Live Activity push
+	LiveActivity *LiveActivity `json:"live_activity,omitempty"`
+
+	// Template renders Title and Body per device locale when deliveries are created
+	Template *TemplateRef `json:"template,omitempty"`
+
+	// Overflow is the strategy applied when a provider payload exceeds its size limit
+	Overflow string `json:"overflow,omitempty"`
+
+	// APNSEnvironment overrides the tenant's APNS environment for one device, from the environment
+	// hinted at registration. It is set per job and never part of the stored payload.
+	APNSEnvironment string `json:"-"`
+}
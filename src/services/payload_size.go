@@ -0,0 +1,194 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/gaulatti/signal/src/models"
+	"github.com/sideshow/apns2"
+)
+
+// Payload overflow strategies
+const (
+	OverflowReject   = "reject"   // fail pushes whose payload exceeds the provider limit
+	OverflowTruncate = "truncate" // shorten the body with an ellipsis until the payload fits
+)
+
+// Provider payload limits in bytes
+const (
+	apnsMaxPayload     = 4096
+	apnsVoIPMaxPayload = 5120
+	fcmMaxPayload      = 4096
+)
+
+// truncationEllipsis is appended to truncated bodies
+const truncationEllipsis = "…"
+
+// PayloadTooLargeError reports a payload that exceeds its provider's size limit
+type PayloadTooLargeError struct {
+	Provider string
+	Size     int
+	Limit    int
+}
+
+func (e *PayloadTooLargeError) Error() string {
+	return fmt.Sprintf("%s payload is %d bytes, %d over the %d-byte limit", e.Provider, e.Size, e.Size-e.Limit, e.Limit)
+}
+
+// fitMessage returns msg, or a copy with a shortened body, whose provider payload fits in limit.
+// Bodies are cut on a rune boundary and end with an ellipsis; custom data is never changed. With
+// the reject strategy, or when the payload is too large even without a body, it returns a
+// *PayloadTooLargeError.
+func fitMessage(provider string, msg *Message, limit int, size func(*Message) (int, error)) (*Message, error) {
+	n, err := size(msg)
+	if err != nil {
+		return nil, err
+	}
+	if n <= limit {
+		return msg, nil
+	}
+	if msg.Overflow != OverflowTruncate || msg.Body == "" {
+		return nil, &PayloadTooLargeError{Provider: provider, Size: n, Limit: limit}
+	}
+
+	fitted := *msg
+	body := msg.Body
+	drop := n - limit + len(truncationEllipsis)
+	for {
+		body = truncateUTF8(body, len(body)-drop)
+		fitted.Body = body + truncationEllipsis
+		if body == "" {
+			fitted.Body = ""
+		}
+
+		n, err = size(&fitted)
+		if err != nil {
+			return nil, err
+		}
+		if n <= limit {
+			return &fitted, nil
+		}
+		if body == "" {
+			return nil, &PayloadTooLargeError{Provider: provider, Size: n, Limit: limit}
+		}
+
+		// JSON escaping can make the cut smaller than measured; drop the remainder and retry
+		drop = n - limit
+	}
+}
+
+// truncateUTF8 shortens s to at most n bytes without splitting a rune
+func truncateUTF8(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// fitAPNSMessage fits a message into the APNS limit, which is larger for VoIP pushes
+func fitAPNSMessage(msg *Message) (*Message, error) {
+	limit := apnsMaxPayload
+	if msg.APNS != nil && msg.APNS.PushType == apns2.PushTypeVOIP {
+		limit = apnsVoIPMaxPayload
+	}
+
+	return fitMessage("apns", msg, limit, func(m *Message) (int, error) {
+		body, err := json.Marshal(buildAPNSPayload(m))
+		return len(body), err
+	})
+}
+
+// fitFCMMessage fits a message into the FCM limit, which covers the notification and data
+func fitFCMMessage(msg *Message) (*Message, error) {
+	return fitMessage("fcm", msg, fcmMaxPayload, func(m *Message) (int, error) {
+		message, err := buildFCMMessage(m)
+		if err != nil {
+			return 0, err
+		}
+
+		notification, err := json.Marshal(message.Notification)
+		if err != nil {
+			return 0, err
+		}
+		data, err := json.Marshal(message.Data)
+		if err != nil {
+			return 0, err
+		}
+		return len(notification) + len(data), nil
+	})
+}
+
+// fitWebPushMessage fits a message into the space Web Push leaves for the payload once encrypted
+func fitWebPushMessage(msg *Message) (*Message, error) {
+	return fitMessage("webpush", msg, maxWebPushPayload, func(m *Message) (int, error) {
+		payload, err := encodeWebPushPayload(m)
+		return len(payload), err
+	})
+}
+
+// ValidatePayloadSize checks that a message fits the provider limits of the given platforms,
+// or of every platform when none are given. Under the truncate strategy only payloads that
+// cannot fit even without a body fail.
+func ValidatePayloadSize(msg *Message, platforms ...string) error {
+	if len(platforms) == 0 {
+		platforms = []string{models.PlatformIOS, models.PlatformAndroid, models.PlatformWeb}
+	}
+
+	for _, platform := range platforms {
+		var err error
+		switch platform {
+		case models.PlatformIOS:
+			_, err = fitAPNSMessage(msg)
+		case models.PlatformAndroid:
+			_, err = fitFCMMessage(msg)
+		case models.PlatformWeb:
+			_, err = fitWebPushMessage(msg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidatePayload checks a push before it is accepted. It applies the configured overflow
+// strategy when the message does not set one, then checks that every variant of a templated
+// message renders and that the message fits the size limits of the given platforms. Errors
+// are a *TemplateError, a *PayloadTooLargeError, or a failure to load the template.
+func (q *Queue) ValidatePayload(tenantID string, msg *Message, platforms ...string) error {
+	if msg.Overflow == "" {
+		msg.Overflow = q.config.PayloadOverflow
+	}
+
+	if msg.Template == nil {
+		return ValidatePayloadSize(msg, platforms...)
+	}
+
+	tmpl, err := loadTemplate(q.db, tenantID, msg.Template.ID)
+	if err != nil {
+		return err
+	}
+
+	for i := range tmpl.Variants {
+		localized, err := renderVariant(&tmpl.Variants[i], msg.Template.Variables)
+		if err != nil {
+			return &TemplateError{TemplateID: msg.Template.ID, Err: err}
+		}
+
+		rendered := *msg
+		rendered.Template = nil
+		rendered.Title = localized.Title
+		rendered.Body = localized.Body
+		if err := ValidatePayloadSize(&rendered, platforms...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"sync"
+)
+
+// Provider is implemented by every push delivery channel (APNS, FCM, ...)
+type Provider interface {
+	// Name returns the short provider identifier, e.g. "apns" or "fcm"
+	Name() string
+	// SendPush delivers a single message to a device token on behalf of a tenant and
+	// returns the provider's message ID
+	SendPush(tenantID, deviceToken string, msg *Message) (string, error)
+	// CleanupOldClients evicts cached per-tenant clients that are no longer in use
+	CleanupOldClients()
+}
+
+// BatchResult is the outcome of one token in a batch send
+type BatchResult struct {
+	MessageID string
+	Err       error
+}
+
+// BatchProvider is implemented by providers that can deliver one message to many device tokens
+// in a single call. The queue uses it to fan out large notifications.
+type BatchProvider interface {
+	Provider
+	// MaxBatchSize returns the largest number of tokens accepted by SendBatch
+	MaxBatchSize() int
+	// SendBatch delivers a message to every token and returns one result per token, in order.
+	// An error means the whole batch failed and applies to every token.
+	SendBatch(tenantID string, deviceTokens []string, msg *Message) ([]BatchResult, error)
+}
+
+// PushPreview is the request a provider would send to one device
+type PushPreview struct {
+	Headers   map[string]string `json:"headers,omitempty"`
+	Payload   interface{}       `json:"payload"`
+	MessageID string            `json:"message_id,omitempty"` // set by providers that validate remotely
+}
+
+// DryRunProvider is implemented by providers that can validate a message for a device token
+// without notifying the device
+type DryRunProvider interface {
+	Provider
+	// DryRun builds and validates the provider request for a device token and returns it
+	DryRun(tenantID, deviceToken string, msg *Message) (*PushPreview, error)
+}
+
+// Compile-time checks that the built-in services satisfy the provider interfaces
+var (
+	_ DryRunProvider = (*APNSService)(nil)
+	_ DryRunProvider = (*FCMService)(nil)
+	_ BatchProvider  = (*FCMService)(nil)
+	_ DryRunProvider = (*WebPushService)(nil)
+)
+
+// ProviderRegistry maps device platforms to the provider that delivers to them
+type ProviderRegistry struct {
+	providers map[string]Provider // platform -> provider
+	mu        sync.RWMutex
+}
+
+// NewProviderRegistry creates an empty provider registry
+func NewProviderRegistry() *ProviderRegistry {
+	return &ProviderRegistry{
+		providers: make(map[string]Provider),
+	}
+}
+
+// Register associates a platform name with a provider, replacing any previous one
+func (r *ProviderRegistry) Register(platform string, provider Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[platform] = provider
+}
+
+// Get returns the provider registered for a platform
+func (r *ProviderRegistry) Get(platform string) (Provider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	provider, exists := r.providers[platform]
+	return provider, exists
+}
+
+// Providers returns each registered provider once, even if it serves several platforms
+func (r *ProviderRegistry) Providers() []Provider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := make(map[Provider]bool)
+	var result []Provider
+	for _, provider := range r.providers {
+		if seen[provider] {
+			continue
+		}
+		seen[provider] = true
+		result = append(result, provider)
+	}
+	return result
+}
+
+// CleanupOldClients runs client cleanup on every registered provider
+func (r *ProviderRegistry) CleanupOldClients() {
+	for _, provider := range r.Providers() {
+		provider.CleanupOldClients()
+	}
+}
@@ -0,0 +1,718 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gaulatti/signal/src/config"
+	"github.com/gaulatti/signal/src/models"
+	"github.com/google/uuid"
+	"github.com/sideshow/apns2/payload"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrAlreadyReplayed is returned when replaying a dead letter that was already requeued
+var ErrAlreadyReplayed = errors.New("dead letter already replayed")
+
+// QuotaExceededError is returned when queueing a notification would take the tenant past its
+// daily or monthly push quota. Nothing is queued in that case.
+type QuotaExceededError struct {
+	Quota     string // "daily" or "monthly"
+	Limit     int64
+	Remaining int64
+	Requested int
+	ResetsAt  time.Time
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s push quota of %d exceeded: %d deliveries requested, %d remaining",
+		e.Quota, e.Limit, e.Requested, e.Remaining)
+}
+
+// Queue persists push jobs in the database and delivers them with a pool of workers
+type Queue struct {
+	db       *gorm.DB
+	registry *ProviderRegistry
+	config   *config.QueueConfig
+	wake     chan struct{}
+}
+
+// NewQueue creates a new push queue instance
+func NewQueue(db *gorm.DB, registry *ProviderRegistry, cfg *config.QueueConfig) *Queue {
+	return &Queue{
+		db:       db,
+		registry: registry,
+		config:   cfg,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Enqueue records a new notification with one delivery and one job per device and returns it
+// A delivery window may hold individual deliveries until a local time or the end of quiet hours.
+func (q *Queue) Enqueue(tenantID string, target Target, devices []models.DeviceToken, msg *Message, window *DeliveryWindow) (*models.Notification, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	notification := &models.Notification{
+		ID:          uuid.New().String(),
+		TenantID:    tenantID,
+		TargetType:  target.Type,
+		Target:      target.Value,
+		UserID:      notificationUserID(target),
+		PayloadHash: hashPayload(payload),
+		Status:      models.NotificationStatusQueued,
+	}
+
+	err = q.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(notification).Error; err != nil {
+			return err
+		}
+		return q.insertDeliveries(tx, notification, devices, msg, window)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue notification: %w", err)
+	}
+
+	q.notify()
+	return notification, nil
+}
+
+// insertDeliveries creates a pending delivery and a job for every device of a notification. Jobs are
+// due immediately unless the delivery window holds them for the device's local time. Templated
+// messages are rendered here so every job carries the payload localized for its device.
+func (q *Queue) insertDeliveries(tx *gorm.DB, notification *models.Notification, devices []models.DeviceToken, msg *Message, window *DeliveryWindow) error {
+	if len(devices) == 0 {
+		return nil
+	}
+
+	payloads, err := renderPayloads(tx, notification.TenantID, msg, devices)
+	if err != nil {
+		return err
+	}
+
+	tenant, err := models.GetTenantByID(tx, notification.TenantID)
+	if err != nil {
+		return fmt.Errorf("failed to load tenant settings: %w", err)
+	}
+
+	now := time.Now()
+	if err := reserveQuota(tx, tenant, len(devices), now); err != nil {
+		return err
+	}
+
+	deliveries := make([]models.Delivery, 0, len(devices))
+	for i := range devices {
+		device := &devices[i]
+
+		providerName := ""
+		if provider, exists := q.registry.Get(device.Platform); exists {
+			providerName = provider.Name()
+		}
+
+		var heldUntil *time.Time
+		if release := releaseTime(now, device, tenant, window); !release.IsZero() {
+			heldUntil = &release
+		}
+
+		deliveries = append(deliveries, models.Delivery{
+			NotificationID: notification.ID,
+			TenantID:       notification.TenantID,
+			DeviceID:       device.ID,
+			UserID:         device.UserID,
+			Platform:       device.Platform,
+			DeviceToken:    device.DeviceToken,
+			Provider:       providerName,
+			Status:         models.DeliveryStatusPending,
+			HeldUntil:      heldUntil,
+		})
+	}
+
+	if err := tx.CreateInBatches(&deliveries, 500).Error; err != nil {
+		return err
+	}
+
+	jobs := make([]models.PushJob, 0, len(deliveries))
+	for i, delivery := range deliveries {
+		availableAt := now
+		if delivery.HeldUntil != nil {
+			availableAt = *delivery.HeldUntil
+		}
+
+		jobs = append(jobs, models.PushJob{
+			NotificationID: notification.ID,
+			DeliveryID:     delivery.ID,
+			TenantID:       notification.TenantID,
+			DeviceID:       delivery.DeviceID,
+			UserID:         delivery.UserID,
+			Platform:       delivery.Platform,
+			DeviceToken:    delivery.DeviceToken,
+			Environment:    devices[i].Environment,
+			Payload:        payloads[i],
+			Status:         models.JobStatusPending,
+			AvailableAt:    availableAt,
+		})
+	}
+
+	return tx.CreateInBatches(&jobs, 500).Error
+}
+
+// reserveQuota records count deliveries against the tenant's usage and fails with a
+// QuotaExceededError if that takes it past a quota. Usage is incremented before it is checked:
+// the upsert locks the usage rows until the transaction ends, so concurrent sends can't both
+// claim the last of a quota, and the caller's rollback releases the reservation.
+func reserveQuota(tx *gorm.DB, tenant *models.Tenant, count int, now time.Time) error {
+	if err := models.IncrementTenantUsage(tx, tenant.TenantID, int64(count), now); err != nil {
+		return fmt.Errorf("failed to record tenant usage: %w", err)
+	}
+
+	quotas := []struct {
+		name   string
+		limit  int64
+		period string
+		resets time.Time
+	}{
+		{"daily", tenant.DailyPushQuota, models.DailyPeriod(now), models.NextDailyPeriod(now)},
+		{"monthly", tenant.MonthlyPushQuota, models.MonthlyPeriod(now), models.NextMonthlyPeriod(now)},
+	}
+
+	for _, quota := range quotas {
+		if quota.limit <= 0 {
+			continue
+		}
+
+		used, err := models.GetTenantUsage(tx, tenant.TenantID, quota.period)
+		if err != nil {
+			return fmt.Errorf("failed to load %s usage: %w", quota.name, err)
+		}
+		if used > quota.limit {
+			return &QuotaExceededError{
+				Quota:     quota.name,
+				Limit:     quota.limit,
+				Remaining: max(0, quota.limit-(used-int64(count))),
+				Requested: count,
+				ResetsAt:  quota.resets,
+			}
+		}
+	}
+	return nil
+}
+
+// hashPayload returns the hex SHA-256 of an encoded message
+func hashPayload(payload []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(payload))
+}
+
+// notify wakes an idle worker without blocking if one is already pending
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start launches the worker pool, the scheduler and the stale-job reaper; they stop when ctx is cancelled
+func (q *Queue) Start(ctx context.Context) {
+	for i := 0; i < q.config.Workers; i++ {
+		go q.work(ctx, i)
+	}
+
+	go q.runScheduler(ctx)
+
+	go func() {
+		ticker := time.NewTicker(q.config.LockTimeout)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				q.releaseStaleJobs()
+			}
+		}
+	}()
+
+	log.Printf("✅ Push queue started (workers: %d, batch: %d)", q.config.Workers, q.config.BatchSize)
+}
+
+// work claims and processes jobs until ctx is cancelled, sleeping when the queue is empty
+func (q *Queue) work(ctx context.Context, workerID int) {
+	for {
+		jobs, err := q.claim(q.config.BatchSize)
+		if err != nil {
+			log.Printf("Queue worker %d failed to claim jobs: %v", workerID, err)
+		}
+
+		q.processJobs(jobs)
+
+		if len(jobs) > 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-time.After(q.config.PollInterval):
+		}
+	}
+}
+
+// claim locks up to limit due jobs and marks them as processing; safe across several instances.
+// Scopes narrow down which jobs are claimed.
+func (q *Queue) claim(limit int, scopes ...func(*gorm.DB) *gorm.DB) ([]models.PushJob, error) {
+	var jobs []models.PushJob
+
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Scopes(scopes...).
+			Where("status = ? AND available_at <= ?", models.JobStatusPending, time.Now()).
+			Order("id").
+			Limit(limit).
+			Find(&jobs).Error; err != nil {
+			return err
+		}
+
+		if len(jobs) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(jobs))
+		for i, job := range jobs {
+			ids[i] = job.ID
+		}
+
+		return tx.Model(&models.PushJob{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":    models.JobStatusProcessing,
+			"locked_at": time.Now(),
+		}).Error
+	})
+
+	return jobs, err
+}
+
+// batchKey identifies claimed jobs that can share one batch request
+type batchKey struct {
+	tenantID       string
+	notificationID string
+	platform       string
+	payload        string
+}
+
+// batchGroup collects the jobs of one batchKey together with the provider that sends them
+type batchGroup struct {
+	provider BatchProvider
+	jobs     []models.PushJob
+}
+
+// processJobs delivers claimed jobs. Jobs whose provider supports batching are grouped per
+// notification, topped up with more due jobs of the same notification and sent in batches;
+// the rest are sent one by one.
+func (q *Queue) processJobs(jobs []models.PushJob) {
+	groups := make(map[batchKey]*batchGroup)
+	var order []batchKey
+
+	for i := range jobs {
+		job := &jobs[i]
+		provider, _ := q.registry.Get(job.Platform)
+		batcher, ok := provider.(BatchProvider)
+		if !ok {
+			q.process(job)
+			continue
+		}
+
+		key := batchKey{job.TenantID, job.NotificationID, job.Platform, job.Payload}
+		if _, exists := groups[key]; !exists {
+			groups[key] = &batchGroup{provider: batcher}
+			order = append(order, key)
+		}
+		groups[key].jobs = append(groups[key].jobs, *job)
+	}
+
+	for _, key := range order {
+		group := groups[key]
+
+		if remaining := q.config.MulticastSize - len(group.jobs); remaining > 0 {
+			more, err := q.claim(remaining, func(db *gorm.DB) *gorm.DB {
+				return db.Where("notification_id = ? AND platform = ? AND payload = ?", key.notificationID, key.platform, key.payload)
+			})
+			if err != nil {
+				log.Printf("Failed to claim more jobs for notification %s: %v", key.notificationID, err)
+			}
+			group.jobs = append(group.jobs, more...)
+		}
+
+		if len(group.jobs) == 1 {
+			q.process(&group.jobs[0])
+			continue
+		}
+		q.processBatch(group.provider, group.jobs)
+	}
+}
+
+// processBatch splits jobs that share a message into provider-sized batches and sends them,
+// running at most MulticastConcurrency batches at a time
+func (q *Queue) processBatch(provider BatchProvider, jobs []models.PushJob) {
+	var msg Message
+	if err := json.Unmarshal([]byte(jobs[0].Payload), &msg); err != nil {
+		for i := range jobs {
+			q.complete(&jobs[i], "", fmt.Errorf("invalid job payload: %w", err))
+		}
+		return
+	}
+
+	size := provider.MaxBatchSize()
+	semaphore := make(chan struct{}, q.config.MulticastConcurrency)
+	var wg sync.WaitGroup
+
+	for start := 0; start < len(jobs); start += size {
+		batch := jobs[start:min(start+size, len(jobs))]
+
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			q.sendBatch(provider, batch, &msg)
+		}()
+	}
+
+	wg.Wait()
+	log.Printf("Push batch of %d %s job(s) processed for notification %s", len(jobs), jobs[0].Platform, jobs[0].NotificationID)
+}
+
+// sendBatch sends one batch and records the outcome of every job in it
+func (q *Queue) sendBatch(provider BatchProvider, jobs []models.PushJob, msg *Message) {
+	tokens := make([]string, len(jobs))
+	for i, job := range jobs {
+		tokens[i] = job.DeviceToken
+	}
+
+	results, batchErr := provider.SendBatch(jobs[0].TenantID, tokens, msg)
+
+	var sent []models.PushJob
+	var messageIDs []string
+	for i := range jobs {
+		sendErr := batchErr
+		if batchErr == nil {
+			sendErr = results[i].Err
+		}
+
+		if sendErr == nil {
+			sent = append(sent, jobs[i])
+			messageIDs = append(messageIDs, results[i].MessageID)
+			continue
+		}
+		q.complete(&jobs[i], "", sendErr)
+	}
+
+	q.completeSent(sent, messageIDs)
+}
+
+// completeSent marks successfully sent jobs and their deliveries in a single transaction
+func (q *Queue) completeSent(jobs []models.PushJob, messageIDs []string) {
+	if len(jobs) == 0 {
+		return
+	}
+
+	now := time.Now()
+	ids := make([]uint, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.ID
+	}
+
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PushJob{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":       models.JobStatusSent,
+			"attempts":     gorm.Expr("attempts + 1"),
+			"last_error":   "",
+			"locked_at":    nil,
+			"completed_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		for i, job := range jobs {
+			if err := tx.Model(&models.Delivery{}).Where("id = ?", job.DeliveryID).Updates(map[string]interface{}{
+				"status":              models.DeliveryStatusSent,
+				"provider_message_id": messageIDs[i],
+				"error":               "",
+				"attempts":            job.Attempts + 1,
+				"sent_at":             now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to update %d sent push jobs: %v", len(jobs), err)
+	}
+}
+
+// process delivers a single claimed job and records the outcome
+func (q *Queue) process(job *models.PushJob) {
+	messageID, sendErr := q.deliver(job)
+	q.complete(job, messageID, sendErr)
+}
+
+// complete records the outcome of a send, scheduling a retry or dead-lettering the job when
+// the send failed
+func (q *Queue) complete(job *models.PushJob, messageID string, sendErr error) {
+	attempts := job.Attempts + 1
+	now := time.Now()
+
+	updates := map[string]interface{}{
+		"attempts":  attempts,
+		"locked_at": nil,
+	}
+	deliveryUpdates := map[string]interface{}{
+		"attempts": attempts,
+	}
+	deadLetter := false
+
+	switch {
+	case sendErr == nil:
+		updates["status"] = models.JobStatusSent
+		updates["last_error"] = ""
+		updates["completed_at"] = now
+		deliveryUpdates["status"] = models.DeliveryStatusSent
+		deliveryUpdates["provider_message_id"] = messageID
+		deliveryUpdates["error"] = ""
+		deliveryUpdates["sent_at"] = now
+
+	case IsRetryable(sendErr) && attempts < q.config.MaxAttempts:
+		delay := backoffDelay(attempts, q.config.RetryBaseDelay, q.config.RetryMaxDelay)
+		log.Printf("Push job %d (%s) failed for tenant %s, retrying in %s (attempt %d/%d): %v",
+			job.ID, job.Platform, job.TenantID, delay, attempts, q.config.MaxAttempts, sendErr)
+		updates["status"] = models.JobStatusPending
+		updates["last_error"] = sendErr.Error()
+		updates["available_at"] = now.Add(delay)
+		deliveryUpdates["error"] = sendErr.Error()
+
+	case IsTokenInvalid(sendErr):
+		log.Printf("Push job %d (%s) rejected device token for tenant %s: %v", job.ID, job.Platform, job.TenantID, sendErr)
+		updates["status"] = models.JobStatusFailed
+		updates["last_error"] = sendErr.Error()
+		updates["completed_at"] = now
+		deliveryUpdates["status"] = models.DeliveryStatusFailed
+		deliveryUpdates["error"] = sendErr.Error()
+		q.pruneDeviceToken(job, sendErr)
+
+	default:
+		log.Printf("Push job %d (%s) failed permanently for tenant %s after %d attempt(s): %v",
+			job.ID, job.Platform, job.TenantID, attempts, sendErr)
+		updates["status"] = models.JobStatusFailed
+		updates["last_error"] = sendErr.Error()
+		updates["completed_at"] = now
+		deliveryUpdates["status"] = models.DeliveryStatusFailed
+		deliveryUpdates["error"] = sendErr.Error()
+		deadLetter = true
+	}
+
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PushJob{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Delivery{}).Where("id = ?", job.DeliveryID).Updates(deliveryUpdates).Error; err != nil {
+			return err
+		}
+
+		// An activity token cannot be updated once its end event has been delivered
+		if sendErr == nil && endsLiveActivity(job) {
+			if _, err := models.EndLiveActivityToken(tx, job.TenantID, job.DeviceToken); err != nil {
+				return err
+			}
+		}
+
+		if !deadLetter {
+			return nil
+		}
+
+		return tx.Create(&models.DeadLetter{
+			JobID:          job.ID,
+			NotificationID: job.NotificationID,
+			DeliveryID:     job.DeliveryID,
+			TenantID:       job.TenantID,
+			DeviceID:       job.DeviceID,
+			UserID:         job.UserID,
+			Platform:       job.Platform,
+			DeviceToken:    job.DeviceToken,
+			Environment:    job.Environment,
+			Payload:        job.Payload,
+			Attempts:       attempts,
+			LastError:      sendErr.Error(),
+		}).Error
+	})
+	if err != nil {
+		log.Printf("Failed to update push job %d: %v", job.ID, err)
+	}
+}
+
+// endsLiveActivity reports whether a job carries the end event of a Live Activity
+func endsLiveActivity(job *models.PushJob) bool {
+	if job.Platform != models.PlatformIOS {
+		return false
+	}
+
+	var msg struct {
+		LiveActivity *LiveActivity `json:"live_activity"`
+	}
+	if err := json.Unmarshal([]byte(job.Payload), &msg); err != nil {
+		return false
+	}
+	return msg.LiveActivity != nil && msg.LiveActivity.Event == payload.LiveActivityEventEnd
+}
+
+// deliver sends a job through the provider registered for its platform, returning the provider message ID
+func (q *Queue) deliver(job *models.PushJob) (string, error) {
+	provider, exists := q.registry.Get(job.Platform)
+	if !exists {
+		return "", fmt.Errorf("unsupported platform: %s", job.Platform)
+	}
+
+	var msg Message
+	if err := json.Unmarshal([]byte(job.Payload), &msg); err != nil {
+		return "", fmt.Errorf("invalid job payload: %w", err)
+	}
+	msg.APNSEnvironment = job.Environment
+
+	return provider.SendPush(job.TenantID, job.DeviceToken, &msg)
+}
+
+// pruneDeviceToken deactivates the registration of a token the provider reported as invalid
+func (q *Queue) pruneDeviceToken(job *models.PushJob, sendErr error) {
+	reason := sendErr.Error()
+	var pushErr *PushError
+	if errors.As(sendErr, &pushErr) {
+		reason = fmt.Sprintf("%s: %s", pushErr.Provider, pushErr.Reason)
+	}
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+
+	count, err := models.DeactivateDeviceToken(q.db, job.TenantID, job.DeviceToken, reason)
+	if err != nil {
+		log.Printf("Failed to deactivate device token for tenant %s: %v", job.TenantID, err)
+		return
+	}
+
+	if count > 0 {
+		log.Printf("🧹 Deactivated %d registration(s) of invalid %s token for tenant %s (%s)", count, job.Platform, job.TenantID, reason)
+	}
+
+	// Live Activity tokens are stored separately from device registrations
+	if job.Platform == models.PlatformIOS {
+		if count, err := models.EndLiveActivityToken(q.db, job.TenantID, job.DeviceToken); err != nil {
+			log.Printf("Failed to end live activity token for tenant %s: %v", job.TenantID, err)
+		} else if count > 0 {
+			log.Printf("🧹 Ended invalid live activity token for tenant %s (%s)", job.TenantID, reason)
+		}
+	}
+}
+
+// releaseStaleJobs returns jobs stuck in processing (e.g. after a crash) to the pending state
+func (q *Queue) releaseStaleJobs() {
+	cutoff := time.Now().Add(-q.config.LockTimeout)
+	result := q.db.Model(&models.PushJob{}).
+		Where("status = ? AND locked_at < ?", models.JobStatusProcessing, cutoff).
+		Updates(map[string]interface{}{
+			"status":    models.JobStatusPending,
+			"locked_at": nil,
+		})
+
+	if result.Error != nil {
+		log.Printf("Failed to release stale push jobs: %v", result.Error)
+		return
+	}
+
+	if result.RowsAffected > 0 {
+		log.Printf("Released %d stale push jobs", result.RowsAffected)
+		q.notify()
+	}
+}
+
+// ListDeadLetters returns the most recent dead letters of a tenant that have not been replayed
+func (q *Queue) ListDeadLetters(tenantID string, limit int) ([]models.DeadLetter, error) {
+	var deadLetters []models.DeadLetter
+	err := q.db.Where("tenant_id = ? AND replayed_at IS NULL", tenantID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&deadLetters).Error
+	return deadLetters, err
+}
+
+// ReplayDeadLetter returns a dead-lettered job to the queue with a fresh retry budget
+func (q *Queue) ReplayDeadLetter(tenantID string, id uint) (*models.DeadLetter, error) {
+	var deadLetter models.DeadLetter
+
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("tenant_id = ? AND id = ?", tenantID, id).
+			First(&deadLetter).Error; err != nil {
+			return err
+		}
+
+		if deadLetter.ReplayedAt != nil {
+			return ErrAlreadyReplayed
+		}
+
+		now := time.Now()
+		result := tx.Model(&models.PushJob{}).
+			Where("id = ? AND status = ?", deadLetter.JobID, models.JobStatusFailed).
+			Updates(map[string]interface{}{
+				"status":       models.JobStatusPending,
+				"attempts":     0,
+				"available_at": now,
+				"completed_at": nil,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		// The original job may have been purged; recreate it from the dead letter
+		if result.RowsAffected == 0 {
+			if err := tx.Create(&models.PushJob{
+				NotificationID: deadLetter.NotificationID,
+				DeliveryID:     deadLetter.DeliveryID,
+				TenantID:       deadLetter.TenantID,
+				DeviceID:       deadLetter.DeviceID,
+				UserID:         deadLetter.UserID,
+				Platform:       deadLetter.Platform,
+				DeviceToken:    deadLetter.DeviceToken,
+				Environment:    deadLetter.Environment,
+				Payload:        deadLetter.Payload,
+				Status:         models.JobStatusPending,
+				AvailableAt:    now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&models.Delivery{}).Where("id = ?", deadLetter.DeliveryID).Updates(map[string]interface{}{
+			"status":   models.DeliveryStatusPending,
+			"attempts": 0,
+			"error":    "",
+		}).Error; err != nil {
+			return err
+		}
+
+		deadLetter.ReplayedAt = &now
+		return tx.Model(&deadLetter).Update("replayed_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	q.notify()
+	return &deadLetter, nil
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gaulatti/signal/src/models"
+)
+
+// Delivery modes controlling when each device receives a notification
+const (
+	DeliveryModeImmediate  = "immediate"           // send as soon as possible
+	DeliveryModeQuietHours = "respect_quiet_hours" // hold sends that fall in the tenant's quiet hours
+	DeliveryModeLocalTime  = "local_time"          // send at the next occurrence of a local time of day
+)
+
+// DeliveryWindow is the per-request delivery timing option
+type DeliveryWindow struct {
+	Mode      string `json:"mode"`
+	LocalTime string `json:"local_time,omitempty"` // "HH:MM", required for local_time mode
+}
+
+// Validate checks the delivery mode and local time
+func (d *DeliveryWindow) Validate() error {
+	switch d.Mode {
+	case "", DeliveryModeImmediate, DeliveryModeQuietHours:
+		return nil
+	case DeliveryModeLocalTime:
+		if _, err := ParseClock(d.LocalTime); err != nil {
+			return fmt.Errorf("local_time: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown delivery mode %q (expected %s, %s or %s)",
+		d.Mode, DeliveryModeImmediate, DeliveryModeQuietHours, DeliveryModeLocalTime)
+}
+
+// holds reports whether the window may delay sends
+func (d *DeliveryWindow) holds() bool {
+	return d != nil && (d.Mode == DeliveryModeQuietHours || d.Mode == DeliveryModeLocalTime)
+}
+
+// ParseClock parses an "HH:MM" time of day into minutes after midnight
+func ParseClock(value string) (int, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// deviceLocation returns the device's timezone, falling back to the tenant default and then UTC
+func deviceLocation(device *models.DeviceToken, tenant *models.Tenant) *time.Location {
+	for _, name := range []string{device.Timezone, tenant.DefaultTimezone} {
+		if name == "" {
+			continue
+		}
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// nextClock returns the first instant at or after now when the local clock reads minutes
+func nextClock(now time.Time, loc *time.Location, minutes int) time.Time {
+	local := now.In(loc)
+	at := time.Date(local.Year(), local.Month(), local.Day(), minutes/60, minutes%60, 0, 0, loc)
+	if at.Before(local) {
+		at = time.Date(local.Year(), local.Month(), local.Day()+1, minutes/60, minutes%60, 0, 0, loc)
+	}
+	return at
+}
+
+// releaseTime returns when a device should receive a notification sent at now under the window.
+// The zero time means the send is not held.
+func releaseTime(now time.Time, device *models.DeviceToken, tenant *models.Tenant, window *DeliveryWindow) time.Time {
+	if !window.holds() {
+		return time.Time{}
+	}
+
+	loc := deviceLocation(device, tenant)
+
+	if window.Mode == DeliveryModeLocalTime {
+		minutes, err := ParseClock(window.LocalTime)
+		if err != nil {
+			return time.Time{}
+		}
+		return nextClock(now, loc, minutes)
+	}
+
+	start, errStart := ParseClock(tenant.QuietHoursStart)
+	end, errEnd := ParseClock(tenant.QuietHoursEnd)
+	if errStart != nil || errEnd != nil || start == end {
+		return time.Time{}
+	}
+
+	local := now.In(loc)
+	current := local.Hour()*60 + local.Minute()
+
+	// Quiet hours may wrap around midnight, e.g. 22:00-08:00
+	quiet := current >= start && current < end
+	if start > end {
+		quiet = current >= start || current < end
+	}
+
+	if !quiet {
+		return time.Time{}
+	}
+	return nextClock(now, loc, end)
+}
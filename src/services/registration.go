@@ -0,0 +1,77 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gaulatti/signal/src/models"
+)
+
+// Device token formats accepted at registration
+var (
+	apnsTokenPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)            // 32 bytes, hex-encoded
+	fcmTokenPattern  = regexp.MustCompile(`^[A-Za-z0-9_:-]{100,500}$`) // e.g. "<instance id>:APA91b..."
+)
+
+// registrationPlatform is a platform value accepted at registration
+type registrationPlatform struct {
+	platform    string
+	environment string // APNS environment hint, iOS only
+}
+
+// registrationPlatforms lists the platform values accepted at registration. Environment hints
+// record which APNS environment an iOS token belongs to; development builds get sandbox tokens.
+var registrationPlatforms = map[string]registrationPlatform{
+	"ios":            {platform: models.PlatformIOS},
+	"ios-sandbox":    {platform: models.PlatformIOS, environment: models.APNSEnvironmentSandbox},
+	"ios-production": {platform: models.PlatformIOS, environment: models.APNSEnvironmentProduction},
+	"android":        {platform: models.PlatformAndroid},
+	"web":            {platform: models.PlatformWeb},
+}
+
+// NormalizePlatform maps a registration platform value, in any case, to the stored platform and
+// the APNS environment it hints at, if any
+func NormalizePlatform(value string) (string, string, error) {
+	normalized, exists := registrationPlatforms[strings.ToLower(strings.TrimSpace(value))]
+	if !exists {
+		return "", "", fmt.Errorf("platform must be one of ios, ios-sandbox, ios-production, android, web")
+	}
+	return normalized.platform, normalized.environment, nil
+}
+
+// CanonicalDeviceToken returns a token in the form it is stored in, for entry points that take a
+// token without its platform. Only APNS tokens change: they are hex and stored lowercase.
+func CanonicalDeviceToken(token string) string {
+	token = strings.TrimSpace(token)
+	if lower := strings.ToLower(token); apnsTokenPattern.MatchString(lower) {
+		return lower
+	}
+	return token
+}
+
+// NormalizeDeviceToken checks that a token has the syntax of its platform's provider and returns
+// it in canonical form: APNS tokens are lowercased, and web tokens are subscription endpoints.
+func NormalizeDeviceToken(platform, token string) (string, error) {
+	token = strings.TrimSpace(token)
+
+	switch platform {
+	case models.PlatformIOS:
+		token = CanonicalDeviceToken(token)
+		if !apnsTokenPattern.MatchString(token) {
+			return "", fmt.Errorf("APNS device tokens are 64 hexadecimal characters")
+		}
+	case models.PlatformAndroid:
+		if !fcmTokenPattern.MatchString(token) {
+			return "", fmt.Errorf("FCM registration tokens are 100 to 500 characters of [A-Za-z0-9_:-]")
+		}
+	case models.PlatformWeb:
+		if err := validateWebPushEndpoint(token); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unsupported platform: %s", platform)
+	}
+
+	return token, nil
+}
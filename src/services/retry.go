@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// PushError is a classified provider failure
+type PushError struct {
+	Provider   string
+	StatusCode int
+	Reason     string
+	Retryable  bool
+	// TokenInvalid is set when the provider reports the device token as dead
+	TokenInvalid bool
+	Err          error
+}
+
+// Error implements the error interface
+func (e *PushError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s push failed: %d (reason: %s)", e.Provider, e.StatusCode, e.Reason)
+	}
+	return fmt.Sprintf("%s push failed: %s", e.Provider, e.Reason)
+}
+
+// Unwrap returns the underlying error, if any
+func (e *PushError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable reports whether a send error is transient and worth retrying
+func IsRetryable(err error) bool {
+	var pushErr *PushError
+	if errors.As(err, &pushErr) && pushErr.Retryable {
+		return true
+	}
+	return isNetworkTimeout(err)
+}
+
+// IsTokenInvalid reports whether a send error means the device token should no longer be used
+func IsTokenInvalid(err error) bool {
+	var pushErr *PushError
+	return errors.As(err, &pushErr) && pushErr.TokenInvalid
+}
+
+// isNetworkTimeout reports whether err was caused by a network or context timeout
+func isNetworkTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// backoffDelay returns the jittered exponential delay before the given retry attempt (1-based)
+func backoffDelay(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	// Equal jitter: keep half the delay and randomize the other half
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gaulatti/signal/src/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotCancellable is returned when cancelling a notification that is no longer scheduled
+var ErrNotCancellable = errors.New("notification is not scheduled")
+
+// scheduledPush is stored with a scheduled notification until it is dispatched
+type scheduledPush struct {
+	Target  Target          `json:"target"`
+	Message *Message        `json:"message"`
+	Window  *DeliveryWindow `json:"window,omitempty"`
+}
+
+// Schedule records a notification that is fanned out to its target when sendAt is reached.
+// The delivery window is applied at that point, relative to the dispatch time.
+func (q *Queue) Schedule(tenantID string, target Target, msg *Message, window *DeliveryWindow, sendAt time.Time) (*models.Notification, error) {
+	messagePayload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	payload, err := json.Marshal(scheduledPush{Target: target, Message: msg, Window: window})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode scheduled push: %w", err)
+	}
+
+	sendAt = sendAt.UTC()
+	notification := &models.Notification{
+		ID:          uuid.New().String(),
+		TenantID:    tenantID,
+		TargetType:  target.Type,
+		Target:      target.Value,
+		UserID:      notificationUserID(target),
+		PayloadHash: hashPayload(messagePayload),
+		Status:      models.NotificationStatusScheduled,
+		SendAt:      &sendAt,
+		Payload:     string(payload),
+	}
+
+	if err := q.db.Create(notification).Error; err != nil {
+		return nil, fmt.Errorf("failed to schedule notification: %w", err)
+	}
+
+	return notification, nil
+}
+
+// ListScheduled returns a tenant's pending scheduled notifications, soonest first
+func (q *Queue) ListScheduled(tenantID string, limit int) ([]models.Notification, error) {
+	var notifications []models.Notification
+	err := q.db.Where("tenant_id = ? AND status = ?", tenantID, models.NotificationStatusScheduled).
+		Order("send_at").
+		Limit(limit).
+		Find(&notifications).Error
+	return notifications, err
+}
+
+// CancelScheduled cancels a scheduled notification that has not been dispatched yet
+func (q *Queue) CancelScheduled(tenantID, notificationID string) error {
+	result := q.db.Model(&models.Notification{}).
+		Where("tenant_id = ? AND id = ? AND status = ?", tenantID, notificationID, models.NotificationStatusScheduled).
+		Updates(map[string]interface{}{
+			"status":  models.NotificationStatusCancelled,
+			"payload": "",
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 1 {
+		return nil
+	}
+
+	// Distinguish an unknown notification from one that already went out
+	var count int64
+	if err := q.db.Model(&models.Notification{}).
+		Where("tenant_id = ? AND id = ?", tenantID, notificationID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return ErrNotCancellable
+}
+
+// BackfillScheduledUserIDs copies the user of device-targeted scheduled notifications created
+// before notifications recorded it from their payload into the user_id column, so that user data
+// exports and erasures find them before they are dispatched
+func (q *Queue) BackfillScheduledUserIDs() error {
+	var notifications []models.Notification
+	err := q.db.Select("id", "payload").
+		Where("status = ? AND target_type = ? AND (user_id IS NULL OR user_id = '')",
+			models.NotificationStatusScheduled, models.TargetDevice).
+		FindInBatches(&notifications, 100, func(tx *gorm.DB, batch int) error {
+			for _, notification := range notifications {
+				var scheduled scheduledPush
+				if err := json.Unmarshal([]byte(notification.Payload), &scheduled); err != nil || scheduled.Target.UserID == "" {
+					continue
+				}
+				if err := q.db.Model(&models.Notification{}).
+					Where("id = ? AND status = ?", notification.ID, models.NotificationStatusScheduled).
+					Update("user_id", scheduled.Target.UserID).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	return err
+}
+
+// runScheduler periodically dispatches due scheduled notifications until ctx is cancelled
+func (q *Queue) runScheduler(ctx context.Context) {
+	ticker := time.NewTicker(q.config.SchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				dispatched, err := q.dispatchNextScheduled()
+				if err != nil {
+					log.Printf("Scheduler failed to dispatch notification: %v", err)
+					break
+				}
+				if !dispatched {
+					break
+				}
+			}
+		}
+	}
+}
+
+// dispatchNextScheduled claims one due scheduled notification and fans it out. Rows are locked
+// with SKIP LOCKED so several instances can run the scheduler against the same database.
+// Failed attempts are counted on the notification, see recordDispatchFailure.
+func (q *Queue) dispatchNextScheduled() (bool, error) {
+	dispatched := false
+	claimed := ""
+
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		var notification models.Notification
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND send_at <= ?", models.NotificationStatusScheduled, time.Now()).
+			Order("send_at").
+			First(&notification).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		claimed = notification.ID
+
+		// A payload that cannot be decoded would block the schedule forever; fail it instead
+		var push scheduledPush
+		if err := json.Unmarshal([]byte(notification.Payload), &push); err != nil {
+			return failScheduled(tx, &notification, fmt.Errorf("invalid payload: %w", err))
+		}
+
+		devices, err := ResolveDevices(tx, notification.TenantID, push.Target)
+		if err != nil {
+			return err
+		}
+
+		// Likewise a template deleted or changed since scheduling can no longer be rendered, and a
+		// send past the tenant's quota is refused. The fan-out runs in a savepoint so a refused
+		// dispatch leaves no deliveries or usage behind.
+		err = tx.Transaction(func(tx *gorm.DB) error {
+			return q.insertDeliveries(tx, &notification, devices, push.Message, push.Window)
+		})
+		var templateErr *TemplateError
+		var quotaErr *QuotaExceededError
+		if errors.As(err, &templateErr) || errors.As(err, &quotaErr) {
+			return failScheduled(tx, &notification, err)
+		}
+		if err != nil {
+			return err
+		}
+
+		dispatched = true
+		log.Printf("⏰ Dispatched scheduled notification %s for tenant %s (devices: %d)", notification.ID, notification.TenantID, len(devices))
+
+		return tx.Model(&notification).Updates(map[string]interface{}{
+			"status":  models.NotificationStatusQueued,
+			"payload": "",
+		}).Error
+	})
+
+	if dispatched {
+		q.notify()
+	}
+	if err != nil && claimed != "" {
+		q.recordDispatchFailure(claimed, err)
+	}
+	return dispatched, err
+}
+
+// failScheduled marks a scheduled notification that can never be dispatched as failed, keeping
+// the reason so the tenant can tell it apart from a cancellation
+func failScheduled(tx *gorm.DB, notification *models.Notification, reason error) error {
+	log.Printf("Scheduled notification %s for tenant %s failed: %v", notification.ID, notification.TenantID, reason)
+	return tx.Model(notification).Updates(map[string]interface{}{
+		"status":     models.NotificationStatusFailed,
+		"last_error": reason.Error(),
+		"payload":    "",
+	}).Error
+}
+
+// recordDispatchFailure counts a failed attempt to dispatch a scheduled notification. Once
+// SchedulerMaxAttempts is reached the notification is marked failed, so one that can never be
+// dispatched stops holding up those due after it.
+func (q *Queue) recordDispatchFailure(notificationID string, dispatchErr error) {
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		var notification models.Notification
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status = ?", notificationID, models.NotificationStatusScheduled).
+			First(&notification).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		attempts := notification.Attempts + 1
+		updates := map[string]interface{}{
+			"attempts":   attempts,
+			"last_error": dispatchErr.Error(),
+		}
+		if attempts >= q.config.SchedulerMaxAttempts {
+			log.Printf("Scheduled notification %s for tenant %s failed after %d attempts: %v",
+				notificationID, notification.TenantID, attempts, dispatchErr)
+			updates["status"] = models.NotificationStatusFailed
+			updates["payload"] = ""
+		}
+		return tx.Model(&notification).Updates(updates).Error
+	})
+	if err != nil {
+		log.Printf("Failed to record dispatch failure of scheduled notification %s: %v", notificationID, err)
+	}
+}
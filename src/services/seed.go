@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"time"
 
 	"github.com/gaulatti/signal/src/models"
 	"gorm.io/gorm"
@@ -19,6 +21,9 @@ type TenantSeedData struct {
 	APIKey     string          `json:"api_key,omitempty"`
 	APNSConfig *APNSConfigSeed `json:"apns_config,omitempty"`
 	FCMConfig  *FCMConfigSeed  `json:"fcm_config,omitempty"`
+	WebPush    *WebPushSeed    `json:"webpush_config,omitempty"`
+	QuietHours *QuietHoursSeed `json:"quiet_hours,omitempty"`
+	Limits     *LimitsSeed     `json:"limits,omitempty"`
 }
 
 type APNSConfigSeed struct {
@@ -33,6 +38,26 @@ type FCMConfigSeed struct {
 	Enabled   bool   `json:"enabled"`
 }
 
+// WebPushSeed configures Web Push; the VAPID private key is read from S3 at webpush/<tenant_id>.pem
+type WebPushSeed struct {
+	Subject string `json:"subject"` // "mailto:ops@example.com" or an https URL
+	Enabled bool   `json:"enabled"`
+}
+
+type QuietHoursSeed struct {
+	Start           string `json:"start"` // "HH:MM"
+	End             string `json:"end"`   // "HH:MM"
+	DefaultTimezone string `json:"default_timezone,omitempty"`
+}
+
+// LimitsSeed configures per-tenant rate limits and push quotas; zero means unlimited
+type LimitsSeed struct {
+	RateLimitPerSecond float64 `json:"rate_limit_per_second"`
+	RateLimitBurst     int     `json:"rate_limit_burst"`
+	DailyPushQuota     int64   `json:"daily_push_quota"`
+	MonthlyPushQuota   int64   `json:"monthly_push_quota"`
+}
+
 // SeedService handles seeding of initial data
 type SeedService struct {
 	db *gorm.DB
@@ -87,9 +112,40 @@ func (s *SeedService) seedTenant(data TenantSeedData) error {
 		Active:      true,
 	}
 
+	updateColumns := []string{"name", "description", "updated_at"}
+	if data.QuietHours != nil {
+		if _, err := ParseClock(data.QuietHours.Start); err != nil {
+			return fmt.Errorf("invalid quiet hours start: %w", err)
+		}
+		if _, err := ParseClock(data.QuietHours.End); err != nil {
+			return fmt.Errorf("invalid quiet hours end: %w", err)
+		}
+		if _, err := time.LoadLocation(data.QuietHours.DefaultTimezone); err != nil {
+			return fmt.Errorf("invalid default timezone: %w", err)
+		}
+
+		tenant.QuietHoursStart = data.QuietHours.Start
+		tenant.QuietHoursEnd = data.QuietHours.End
+		tenant.DefaultTimezone = data.QuietHours.DefaultTimezone
+		updateColumns = append(updateColumns, "quiet_hours_start", "quiet_hours_end", "default_timezone")
+	}
+
+	if data.Limits != nil {
+		if data.Limits.RateLimitPerSecond < 0 || data.Limits.RateLimitBurst < 0 ||
+			data.Limits.DailyPushQuota < 0 || data.Limits.MonthlyPushQuota < 0 {
+			return fmt.Errorf("limits must not be negative")
+		}
+
+		tenant.RateLimitPerSecond = data.Limits.RateLimitPerSecond
+		tenant.RateLimitBurst = data.Limits.RateLimitBurst
+		tenant.DailyPushQuota = data.Limits.DailyPushQuota
+		tenant.MonthlyPushQuota = data.Limits.MonthlyPushQuota
+		updateColumns = append(updateColumns, "rate_limit_per_second", "rate_limit_burst", "daily_push_quota", "monthly_push_quota")
+	}
+
 	if err := s.db.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "tenant_id"}},
-		DoUpdates: clause.AssignmentColumns([]string{"name", "description", "updated_at"}),
+		DoUpdates: clause.AssignmentColumns(updateColumns),
 	}).Create(&tenant).Error; err != nil {
 		return fmt.Errorf("failed to create tenant: %w", err)
 	}
@@ -146,5 +202,26 @@ func (s *SeedService) seedTenant(data TenantSeedData) error {
 		}
 	}
 
+	// Create or update Web Push config if provided
+	if data.WebPush != nil {
+		subject, err := url.Parse(data.WebPush.Subject)
+		if err != nil || (subject.Scheme != "mailto" && subject.Scheme != "https") {
+			return fmt.Errorf("invalid Web Push subject: expected a mailto: or https: URL")
+		}
+
+		webPushConfig := models.WebPushConfig{
+			TenantID: data.TenantID,
+			Subject:  data.WebPush.Subject,
+			Active:   data.WebPush.Enabled,
+		}
+
+		if err := s.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "tenant_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"subject", "active", "updated_at"}),
+		}).Create(&webPushConfig).Error; err != nil {
+			return fmt.Errorf("failed to create Web Push config: %w", err)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gaulatti/signal/src/models"
+	"gorm.io/gorm"
+)
+
+// Limits that keep segment expressions and device attributes reasonably sized
+const (
+	maxSegmentLen      = 500 // fits the notification target column
+	maxSegmentTerms    = 50
+	maxAttributeCount  = 100
+	maxAttributeValLen = 255
+)
+
+// attributeKeyPattern matches valid attribute keys
+var attributeKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+// segmentColumns maps the segment fields answered from device_tokens columns instead of attributes
+var segmentColumns = map[string]string{
+	"platform": "device_tokens.platform",
+	"user_id":  "device_tokens.user_id",
+	"timezone": "device_tokens.timezone",
+	"locale":   "device_tokens.locale",
+}
+
+// ValidateDeviceAttributes checks attributes and tags before they are stored on a device
+func ValidateDeviceAttributes(attributes map[string]string, tags []string) error {
+	if len(attributes)+len(tags) > maxAttributeCount {
+		return fmt.Errorf("a device can have at most %d attributes and tags", maxAttributeCount)
+	}
+
+	for key, value := range attributes {
+		if !attributeKeyPattern.MatchString(key) {
+			return fmt.Errorf("attribute key %q must match [a-zA-Z0-9_.-]{1,64}", key)
+		}
+		if key == models.AttributeKeyTag || segmentColumns[key] != "" {
+			return fmt.Errorf("attribute key %q is reserved", key)
+		}
+		if value == "" || len(value) > maxAttributeValLen {
+			return fmt.Errorf("attribute %q must have a value of 1 to %d characters", key, maxAttributeValLen)
+		}
+	}
+
+	for _, tag := range tags {
+		if tag == "" || len(tag) > maxAttributeValLen {
+			return fmt.Errorf("tags must be 1 to %d characters", maxAttributeValLen)
+		}
+	}
+
+	return nil
+}
+
+// Segment is a compiled segment filter expression. Expressions combine key:value terms with
+// AND, OR, NOT and parentheses, e.g. `tag:beta AND (locale:es* OR NOT plan:free)`. A trailing
+// or embedded * in a value is a wildcard, and values with spaces can be double-quoted.
+type Segment struct {
+	Expression string
+	sql        string
+	args       []interface{}
+}
+
+// ParseSegment parses and compiles a segment expression
+func ParseSegment(expression string) (*Segment, error) {
+	if len(expression) > maxSegmentLen {
+		return nil, fmt.Errorf("segment must be at most %d characters", maxSegmentLen)
+	}
+
+	tokens, err := tokenizeSegment(expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("segment is empty")
+	}
+
+	parser := &segmentParser{tokens: tokens}
+	sql, args, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(tokens) {
+		return nil, fmt.Errorf("unexpected %q", tokens[parser.pos].text)
+	}
+
+	return &Segment{Expression: expression, sql: sql, args: args}, nil
+}
+
+// Apply narrows a device_tokens query to the devices matching the segment
+func (s *Segment) Apply(db *gorm.DB) *gorm.DB {
+	return db.Where(s.sql, s.args...)
+}
+
+// segmentToken is a lexical token of a segment expression
+type segmentToken struct {
+	text   string
+	quoted bool // quoted terms are never keywords
+}
+
+// tokenizeSegment splits an expression into parentheses, keywords and key:value terms
+func tokenizeSegment(expression string) ([]segmentToken, error) {
+	var tokens []segmentToken
+	var current strings.Builder
+	inQuotes, quoted := false, false
+
+	flush := func() {
+		if current.Len() > 0 || quoted {
+			tokens = append(tokens, segmentToken{text: current.String(), quoted: quoted})
+		}
+		current.Reset()
+		quoted = false
+	}
+
+	for _, r := range expression {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			quoted = true
+		case inQuotes:
+			current.WriteRune(r)
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, segmentToken{text: string(r)})
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	flush()
+	return tokens, nil
+}
+
+// segmentParser is a recursive descent parser that compiles a segment into a SQL condition:
+//
+//	or   := and { OR and }
+//	and  := not { AND not }
+//	not  := NOT not | "(" or ")" | term
+type segmentParser struct {
+	tokens []segmentToken
+	pos    int
+	terms  int
+}
+
+// keyword reports whether the next token is the given keyword and consumes it if so
+func (p *segmentParser) keyword(word string) bool {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *segmentParser) parseOr() (string, []interface{}, error) {
+	sql, args, err := p.parseAnd()
+	if err != nil {
+		return "", nil, err
+	}
+
+	for p.keyword("OR") {
+		right, rightArgs, err := p.parseAnd()
+		if err != nil {
+			return "", nil, err
+		}
+		sql = "(" + sql + " OR " + right + ")"
+		args = append(args, rightArgs...)
+	}
+	return sql, args, nil
+}
+
+func (p *segmentParser) parseAnd() (string, []interface{}, error) {
+	sql, args, err := p.parseNot()
+	if err != nil {
+		return "", nil, err
+	}
+
+	for p.keyword("AND") {
+		right, rightArgs, err := p.parseNot()
+		if err != nil {
+			return "", nil, err
+		}
+		sql = "(" + sql + " AND " + right + ")"
+		args = append(args, rightArgs...)
+	}
+	return sql, args, nil
+}
+
+func (p *segmentParser) parseNot() (string, []interface{}, error) {
+	if p.keyword("NOT") {
+		sql, args, err := p.parseNot()
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT " + sql, args, nil
+	}
+
+	if p.pos >= len(p.tokens) {
+		return "", nil, fmt.Errorf("unexpected end of segment")
+	}
+
+	token := p.tokens[p.pos]
+	if token.text == "(" && !token.quoted {
+		p.pos++
+		sql, args, err := p.parseOr()
+		if err != nil {
+			return "", nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].text != ")" {
+			return "", nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return "(" + sql + ")", args, nil
+	}
+
+	if token.text == ")" && !token.quoted {
+		return "", nil, fmt.Errorf("unexpected )")
+	}
+	if !token.quoted && (strings.EqualFold(token.text, "AND") || strings.EqualFold(token.text, "OR")) {
+		return "", nil, fmt.Errorf("unexpected %s", strings.ToUpper(token.text))
+	}
+
+	p.pos++
+	return p.compileTerm(token.text)
+}
+
+// compileTerm turns a key:value term into a condition on a device column or an EXISTS
+// subquery on device_attributes
+func (p *segmentParser) compileTerm(term string) (string, []interface{}, error) {
+	p.terms++
+	if p.terms > maxSegmentTerms {
+		return "", nil, fmt.Errorf("segment can have at most %d terms", maxSegmentTerms)
+	}
+
+	key, value, found := strings.Cut(term, ":")
+	if !found || value == "" {
+		return "", nil, fmt.Errorf("term %q must be key:value", term)
+	}
+	if !attributeKeyPattern.MatchString(key) {
+		return "", nil, fmt.Errorf("invalid key in term %q", term)
+	}
+
+	operator, pattern := "=", value
+	if strings.Contains(value, "*") {
+		operator, pattern = "LIKE", likePattern(value)
+	}
+
+	// Platforms match like at registration, so platform:IOS and platform:ios-sandbox work
+	if key == "platform" && operator == "=" {
+		platform, environment, err := NormalizePlatform(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("term %q: %w", term, err)
+		}
+		if environment != "" {
+			return "(device_tokens.platform = ? AND device_tokens.environment = ?)", []interface{}{platform, environment}, nil
+		}
+		pattern = platform
+	}
+
+	if column, builtin := segmentColumns[key]; builtin {
+		return fmt.Sprintf("%s %s ?", column, operator), []interface{}{pattern}, nil
+	}
+
+	sql := fmt.Sprintf("EXISTS (SELECT 1 FROM device_attributes WHERE device_attributes.device_id = device_tokens.id "+
+		"AND device_attributes.attribute_key = ? AND device_attributes.attribute_value %s ?)", operator)
+	return sql, []interface{}{key, pattern}, nil
+}
+
+// likePattern converts a value with * wildcards into a LIKE pattern, escaping LIKE metacharacters
+func likePattern(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+	return strings.ReplaceAll(escaped, "*", "%")
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gaulatti/signal/src/models"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// attrSQL is the condition compileTerm emits for an exact match on a device attribute
+const attrSQL = "EXISTS (SELECT 1 FROM device_attributes WHERE device_attributes.device_id = device_tokens.id " +
+	"AND device_attributes.attribute_key = ? AND device_attributes.attribute_value = ?)"
+
+func TestParseSegment(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		wantSQL    string
+		wantArgs   []interface{}
+	}{
+		{
+			name:       "tag",
+			expression: "tag:beta",
+			wantSQL:    attrSQL,
+			wantArgs:   []interface{}{models.AttributeKeyTag, "beta"},
+		},
+		{
+			name:       "AND binds tighter than OR",
+			expression: "a:1 OR b:2 AND c:3",
+			wantSQL:    "(" + attrSQL + " OR (" + attrSQL + " AND " + attrSQL + "))",
+			wantArgs:   []interface{}{"a", "1", "b", "2", "c", "3"},
+		},
+		{
+			name:       "NOT binds tighter than AND",
+			expression: "NOT a:1 AND b:2",
+			wantSQL:    "(NOT " + attrSQL + " AND " + attrSQL + ")",
+			wantArgs:   []interface{}{"a", "1", "b", "2"},
+		},
+		{
+			name:       "parentheses override precedence",
+			expression: "(a:1 OR b:2) AND c:3",
+			wantSQL:    "(((" + attrSQL + " OR " + attrSQL + ")) AND " + attrSQL + ")",
+			wantArgs:   []interface{}{"a", "1", "b", "2", "c", "3"},
+		},
+		{
+			name:       "NOT applies to a parenthesized group",
+			expression: "NOT (a:1 OR b:2)",
+			wantSQL:    "NOT ((" + attrSQL + " OR " + attrSQL + "))",
+			wantArgs:   []interface{}{"a", "1", "b", "2"},
+		},
+		{
+			name:       "keywords are case-insensitive",
+			expression: "a:1 or not b:2",
+			wantSQL:    "(" + attrSQL + " OR NOT " + attrSQL + ")",
+			wantArgs:   []interface{}{"a", "1", "b", "2"},
+		},
+		{
+			name:       "quoted value with spaces",
+			expression: `city:"New York"`,
+			wantSQL:    attrSQL,
+			wantArgs:   []interface{}{"city", "New York"},
+		},
+		{
+			name:       "quoted value with a keyword and parentheses",
+			expression: `title:"this AND (that)"`,
+			wantSQL:    attrSQL,
+			wantArgs:   []interface{}{"title", "this AND (that)"},
+		},
+		{
+			name:       "trailing wildcard",
+			expression: "locale:es*",
+			wantSQL:    "device_tokens.locale LIKE ?",
+			wantArgs:   []interface{}{"es%"},
+		},
+		{
+			name:       "wildcard escapes LIKE metacharacters",
+			expression: `promo:50%_off*`,
+			wantSQL:    strings.Replace(attrSQL, "attribute_value = ?", "attribute_value LIKE ?", 1),
+			wantArgs:   []interface{}{"promo", `50\%\_off%`},
+		},
+		{
+			name:       "device column",
+			expression: "user_id:alice",
+			wantSQL:    "device_tokens.user_id = ?",
+			wantArgs:   []interface{}{"alice"},
+		},
+		{
+			name:       "platform is normalized",
+			expression: "platform:IOS",
+			wantSQL:    "device_tokens.platform = ?",
+			wantArgs:   []interface{}{models.PlatformIOS},
+		},
+		{
+			name:       "platform with an environment hint",
+			expression: "platform:ios-sandbox",
+			wantSQL:    "(device_tokens.platform = ? AND device_tokens.environment = ?)",
+			wantArgs:   []interface{}{models.PlatformIOS, models.APNSEnvironmentSandbox},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segment, err := ParseSegment(tt.expression)
+			if err != nil {
+				t.Fatalf("ParseSegment(%q) error = %v", tt.expression, err)
+			}
+			if segment.sql != tt.wantSQL {
+				t.Errorf("ParseSegment(%q) sql =\n%s\nwant\n%s", tt.expression, segment.sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(segment.args, tt.wantArgs) {
+				t.Errorf("ParseSegment(%q) args = %#v, want %#v", tt.expression, segment.args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestParseSegmentErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		wantErr    string
+	}{
+		{expression: "", wantErr: "segment is empty"},
+		{expression: "   ", wantErr: "segment is empty"},
+		{expression: "beta", wantErr: "must be key:value"},
+		{expression: "tag:", wantErr: "must be key:value"},
+		{expression: "bad$key:x", wantErr: "invalid key"},
+		{expression: "a:1 AND", wantErr: "unexpected end of segment"},
+		{expression: "NOT", wantErr: "unexpected end of segment"},
+		{expression: "AND a:1", wantErr: "unexpected AND"},
+		{expression: "a:1 OR OR b:2", wantErr: "unexpected OR"},
+		{expression: "(a:1 OR b:2", wantErr: "missing closing parenthesis"},
+		{expression: "a:1)", wantErr: `unexpected ")"`},
+		{expression: "()", wantErr: "unexpected )"},
+		{expression: "a:1 b:2", wantErr: `unexpected "b:2"`},
+		{expression: `city:"New York`, wantErr: "unterminated quote"},
+		{expression: `"AND"`, wantErr: "must be key:value"},
+		{expression: "platform:blackberry", wantErr: "platform must be one of"},
+		{expression: strings.Repeat("a:1 OR ", 50) + "a:1", wantErr: "at most 50 terms"},
+		{expression: "tag:" + strings.Repeat("x", maxSegmentLen), wantErr: "at most 500 characters"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseSegment(tt.expression)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ParseSegment(%q) error = %v, want one containing %q", tt.expression, err, tt.wantErr)
+		}
+	}
+}
+
+// TestSegmentApplyBindsValues checks that values reach the database as bound parameters and
+// never as part of the SQL text, however they are quoted
+func TestSegmentApplyBindsValues(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "user@tcp(127.0.0.1:3306)/signal", SkipInitializeWithVersion: true}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	injections := []string{
+		`plan:"x' OR '1'='1"`,
+		`user_id:"alice OR 1=1 --"`,
+		`locale:"es'; DROP TABLE device_tokens; --"*`,
+	}
+
+	for _, expression := range injections {
+		segment, err := ParseSegment(expression)
+		if err != nil {
+			t.Fatalf("ParseSegment(%q) error = %v", expression, err)
+		}
+
+		var devices []models.DeviceToken
+		statement := segment.Apply(db.Model(&models.DeviceToken{})).Find(&devices).Statement
+		sql := statement.SQL.String()
+
+		for _, fragment := range []string{"'1'='1", "1=1", "DROP TABLE"} {
+			if strings.Contains(sql, fragment) {
+				t.Errorf("segment %q leaked %q into the SQL: %s", expression, fragment, sql)
+			}
+		}
+		if len(statement.Vars) != len(segment.args) {
+			t.Errorf("segment %q bound %d values, want %d: %s", expression, len(statement.Vars), len(segment.args), sql)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gaulatti/signal/src/models"
+	"gorm.io/gorm"
+)
+
+// Target describes who a notification is addressed to
+type Target struct {
+	Type     string `json:"type"`               // one of the models.Target* constants
+	Value    string `json:"value,omitempty"`    // user ID, device token, topic or condition; empty for tenant-wide sends
+	Platform string `json:"platform,omitempty"` // platform of a device target
+	UserID   string `json:"user_id,omitempty"`  // user reported for a device target, or narrowing a segment
+}
+
+// ResolveDevices returns the devices a target currently addresses. A device target resolves to
+// its registration when the token is known, or to an unregistered device on the target platform.
+// Topic and condition targets resolve to one Android device without a token.
+func ResolveDevices(db *gorm.DB, tenantID string, target Target) ([]models.DeviceToken, error) {
+	// FCM fans topic and condition sends out itself, so they are a single Android delivery
+	if target.Type == models.TargetTopic || target.Type == models.TargetCondition {
+		return []models.DeviceToken{{
+			TenantID: tenantID,
+			UserID:   target.UserID,
+			Platform: models.PlatformAndroid,
+		}}, nil
+	}
+
+	if target.Type == models.TargetDevice {
+		var device models.DeviceToken
+		err := db.Where("tenant_id = ? AND device_token = ? AND platform = ?", tenantID, target.Value, target.Platform).
+			First(&device).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return []models.DeviceToken{{
+				TenantID:    tenantID,
+				UserID:      target.UserID,
+				Platform:    target.Platform,
+				DeviceToken: target.Value,
+			}}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []models.DeviceToken{device}, nil
+	}
+
+	var devices []models.DeviceToken
+	query := db.Where("tenant_id = ? AND active = ?", tenantID, true)
+
+	switch target.Type {
+	case models.TargetUser:
+		query = query.Where("user_id = ?", target.Value)
+	case models.TargetSegment:
+		segment, err := ParseSegment(target.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid segment: %w", err)
+		}
+		query = segment.Apply(query)
+		if target.UserID != "" {
+			query = query.Where("user_id = ?", target.UserID)
+		}
+	}
+
+	err := query.Find(&devices).Error
+	return devices, err
+}
+
+// notificationUserID returns the user recorded on a notification for target. Only device targets
+// carry one: the user of a user target is the target itself, and topic, condition and segment
+// sends are not the user's data even when narrowed to them.
+func notificationUserID(target Target) string {
+	if target.Type != models.TargetDevice {
+		return ""
+	}
+	return target.UserID
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/gaulatti/signal/src/models"
+	"gorm.io/gorm"
+)
+
+// ErrTemplateNotFound is returned when a push references a template the tenant does not have
+var ErrTemplateNotFound = errors.New("template not found")
+
+// localePattern matches BCP 47 style locales such as "es", "pt-BR" or "zh-Hant-TW"
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// templateIDPattern matches valid template identifiers
+var templateIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,100}$`)
+
+// TemplateRef makes a message render its title and body from a stored template
+type TemplateRef struct {
+	ID        string                 `json:"template_id"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// TemplateError reports a template that could not be found or rendered
+type TemplateError struct {
+	TemplateID string
+	Err        error
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("template %s: %v", e.TemplateID, e.Err)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// NormalizeLocale validates a locale and returns it in canonical form ("es_mx" -> "es-MX")
+func NormalizeLocale(locale string) (string, error) {
+	locale = strings.ReplaceAll(locale, "_", "-")
+	if !localePattern.MatchString(locale) {
+		return "", fmt.Errorf("locale must look like \"es\" or \"pt-BR\"")
+	}
+
+	parts := strings.Split(locale, "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		switch len(parts[i]) {
+		case 2:
+			parts[i] = strings.ToUpper(parts[i]) // region
+		case 4:
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:]) // script
+		default:
+			parts[i] = strings.ToLower(parts[i])
+		}
+	}
+	return strings.Join(parts, "-"), nil
+}
+
+// ValidateTemplate checks a template before it is stored: identifiers and locales must be
+// valid, every variant must parse, and the default locale must have a variant
+func ValidateTemplate(tmpl *models.Template) error {
+	if !templateIDPattern.MatchString(tmpl.TemplateID) {
+		return fmt.Errorf("template_id must match [a-zA-Z0-9_.-]{1,100}")
+	}
+
+	if len(tmpl.Variants) == 0 {
+		return fmt.Errorf("at least one variant is required")
+	}
+
+	defaultLocale, err := NormalizeLocale(tmpl.DefaultLocale)
+	if err != nil {
+		return fmt.Errorf("default_locale: %w", err)
+	}
+	tmpl.DefaultLocale = defaultLocale
+
+	seen := make(map[string]bool, len(tmpl.Variants))
+	for i := range tmpl.Variants {
+		variant := &tmpl.Variants[i]
+
+		locale, err := NormalizeLocale(variant.Locale)
+		if err != nil {
+			return fmt.Errorf("variant %q: %w", variant.Locale, err)
+		}
+		if seen[locale] {
+			return fmt.Errorf("duplicate variant for locale %s", locale)
+		}
+		seen[locale] = true
+		variant.Locale = locale
+
+		if variant.Title == "" || variant.Body == "" {
+			return fmt.Errorf("variant %s requires title and body", locale)
+		}
+		if _, err := parseTemplateText(variant.Title); err != nil {
+			return fmt.Errorf("variant %s title: %w", locale, err)
+		}
+		if _, err := parseTemplateText(variant.Body); err != nil {
+			return fmt.Errorf("variant %s body: %w", locale, err)
+		}
+	}
+
+	if !seen[tmpl.DefaultLocale] {
+		return fmt.Errorf("default_locale %s has no variant", tmpl.DefaultLocale)
+	}
+	return nil
+}
+
+// matchVariant picks the variant that best matches a device locale: an exact match, then the
+// same language ("es-MX" -> "es", then "es-ES"), then the template's default locale
+func matchVariant(tmpl *models.Template, locale string) *models.TemplateVariant {
+	byLocale := make(map[string]*models.TemplateVariant, len(tmpl.Variants))
+	for i := range tmpl.Variants {
+		byLocale[strings.ToLower(tmpl.Variants[i].Locale)] = &tmpl.Variants[i]
+	}
+
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if locale != "" {
+		if variant, exists := byLocale[locale]; exists {
+			return variant
+		}
+
+		language, _, _ := strings.Cut(locale, "-")
+		if variant, exists := byLocale[language]; exists {
+			return variant
+		}
+		for i := range tmpl.Variants {
+			if variantLanguage, _, _ := strings.Cut(strings.ToLower(tmpl.Variants[i].Locale), "-"); variantLanguage == language {
+				return &tmpl.Variants[i]
+			}
+		}
+	}
+
+	return byLocale[strings.ToLower(tmpl.DefaultLocale)]
+}
+
+// renderPayloads returns the JSON payload of msg for every device. Messages without a template
+// share one payload; templated messages are rendered in the best-matching locale of each device.
+func renderPayloads(db *gorm.DB, tenantID string, msg *Message, devices []models.DeviceToken) ([]string, error) {
+	payloads := make([]string, len(devices))
+
+	if msg.Template == nil {
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode message: %w", err)
+		}
+		for i := range payloads {
+			payloads[i] = string(payload)
+		}
+		return payloads, nil
+	}
+
+	tmpl, err := loadTemplate(db, tenantID, msg.Template.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := make(map[*models.TemplateVariant]string)
+	for i := range devices {
+		variant := matchVariant(tmpl, devices[i].Locale)
+		if payload, exists := rendered[variant]; exists {
+			payloads[i] = payload
+			continue
+		}
+
+		localized, err := renderVariant(variant, msg.Template.Variables)
+		if err != nil {
+			return nil, &TemplateError{TemplateID: tmpl.TemplateID, Err: err}
+		}
+
+		message := *msg
+		message.Template = nil
+		message.Title = localized.Title
+		message.Body = localized.Body
+
+		payload, err := json.Marshal(&message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode message: %w", err)
+		}
+		rendered[variant] = string(payload)
+		payloads[i] = string(payload)
+	}
+
+	return payloads, nil
+}
+
+// loadTemplate loads a tenant's template, reporting a missing one as a TemplateError
+func loadTemplate(db *gorm.DB, tenantID, templateID string) (*models.Template, error) {
+	tmpl, err := models.GetTemplate(db, tenantID, templateID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, &TemplateError{TemplateID: templateID, Err: ErrTemplateNotFound}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderVariant executes the title and body of a variant with the given variables
+func renderVariant(variant *models.TemplateVariant, variables map[string]interface{}) (*models.TemplateVariant, error) {
+	title, err := executeTemplateText(variant.Title, variables)
+	if err != nil {
+		return nil, fmt.Errorf("%s title: %w", variant.Locale, err)
+	}
+
+	body, err := executeTemplateText(variant.Body, variables)
+	if err != nil {
+		return nil, fmt.Errorf("%s body: %w", variant.Locale, err)
+	}
+
+	return &models.TemplateVariant{Locale: variant.Locale, Title: title, Body: body}, nil
+}
+
+// parseTemplateText parses template text; missing variables are errors rather than "<no value>"
+func parseTemplateText(text string) (*template.Template, error) {
+	return template.New("text").Option("missingkey=error").Parse(text)
+}
+
+// executeTemplateText renders template text with the given variables
+func executeTemplateText(text string, variables map[string]interface{}) (string, error) {
+	tmpl, err := parseTemplateText(text)
+	if err != nil {
+		return "", err
+	}
+
+	if variables == nil {
+		variables = map[string]interface{}{}
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, variables); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/gaulatti/signal/src/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// topicPattern matches the topic names FCM accepts
+var topicPattern = regexp.MustCompile(`^[a-zA-Z0-9-_.~%]{1,900}$`)
+
+// NormalizeTopic strips an optional "/topics/" prefix and validates the topic name
+func NormalizeTopic(topic string) (string, error) {
+	topic = strings.TrimPrefix(topic, "/topics/")
+	if !topicPattern.MatchString(topic) {
+		return "", fmt.Errorf("topic must match [a-zA-Z0-9-_.~%%]+")
+	}
+	return topic, nil
+}
+
+// TopicFailure reports a token that could not be (un)subscribed
+type TopicFailure struct {
+	DeviceToken string `json:"device_token"`
+	Reason      string `json:"reason"`
+}
+
+// TopicResult is the outcome of a topic subscription change
+type TopicResult struct {
+	Topic     string         `json:"topic"`
+	Succeeded int            `json:"succeeded"`
+	Failures  []TopicFailure `json:"failures,omitempty"`
+}
+
+// TopicManager manages FCM topic subscriptions and keeps a record of them per device
+type TopicManager struct {
+	db  *gorm.DB
+	fcm *FCMService
+}
+
+// NewTopicManager creates a new topic manager instance
+func NewTopicManager(db *gorm.DB, fcm *FCMService) *TopicManager {
+	return &TopicManager{db: db, fcm: fcm}
+}
+
+// Subscribe subscribes registered Android device tokens to a topic and records the subscriptions.
+// Tokens that are not registered to the tenant are reported as failures.
+func (m *TopicManager) Subscribe(tenantID, topic string, deviceTokens []string) (*TopicResult, error) {
+	devices, result, err := m.registeredDevices(tenantID, topic, deviceTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	subscribed, err := m.apply(tenantID, topic, devices, result, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(subscribed) > 0 {
+		records := make([]models.TopicSubscription, len(subscribed))
+		for i, device := range subscribed {
+			records[i] = models.TopicSubscription{
+				TenantID:    tenantID,
+				DeviceID:    device.ID,
+				Topic:       topic,
+				DeviceToken: device.DeviceToken,
+			}
+		}
+
+		if err := m.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "device_id"}, {Name: "topic"}},
+			DoUpdates: clause.AssignmentColumns([]string{"device_token", "updated_at"}),
+		}).CreateInBatches(&records, 500).Error; err != nil {
+			return nil, fmt.Errorf("failed to record topic subscriptions: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// Unsubscribe unsubscribes registered Android device tokens from a topic and removes the records
+func (m *TopicManager) Unsubscribe(tenantID, topic string, deviceTokens []string) (*TopicResult, error) {
+	devices, result, err := m.registeredDevices(tenantID, topic, deviceTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	unsubscribed, err := m.apply(tenantID, topic, devices, result, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(unsubscribed) > 0 {
+		ids := make([]uint, len(unsubscribed))
+		for i, device := range unsubscribed {
+			ids[i] = device.ID
+		}
+
+		if err := m.db.Where("tenant_id = ? AND topic = ? AND device_id IN ?", tenantID, topic, ids).
+			Delete(&models.TopicSubscription{}).Error; err != nil {
+			return nil, fmt.Errorf("failed to remove topic subscriptions: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// Resubscribe subscribes a device's new token to every topic recorded for the device. It is
+// called when a registration's token changes, since FCM subscriptions belong to the old token.
+func (m *TopicManager) Resubscribe(tenantID string, device *models.DeviceToken) error {
+	var subscriptions []models.TopicSubscription
+	if err := m.db.Where("tenant_id = ? AND device_id = ?", tenantID, device.ID).
+		Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	for _, subscription := range subscriptions {
+		if subscription.DeviceToken == device.DeviceToken {
+			continue
+		}
+
+		failures, err := m.fcm.SubscribeToTopic(tenantID, []string{device.DeviceToken}, subscription.Topic)
+		if err != nil {
+			return err
+		}
+		if reason, failed := failures[0]; failed {
+			log.Printf("Failed to resubscribe device %d to topic %s for tenant %s: %s", device.ID, subscription.Topic, tenantID, reason)
+			continue
+		}
+
+		if err := m.db.Model(&subscription).Update("device_token", device.DeviceToken).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(subscriptions) > 0 {
+		log.Printf("Resubscribed device %d to %d topic(s) for tenant %s", device.ID, len(subscriptions), tenantID)
+	}
+	return nil
+}
+
+// UnsubscribeDevice unsubscribes a device's token from every topic recorded for the device, so
+// topic pushes stop reaching it once the registration is deleted. Records are left to the caller.
+func (m *TopicManager) UnsubscribeDevice(tenantID string, device *models.DeviceToken) error {
+	var subscriptions []models.TopicSubscription
+	if err := m.db.Where("tenant_id = ? AND device_id = ?", tenantID, device.ID).
+		Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	for _, subscription := range subscriptions {
+		failures, err := m.fcm.UnsubscribeFromTopic(tenantID, []string{subscription.DeviceToken}, subscription.Topic)
+		if err != nil {
+			return err
+		}
+		if reason, failed := failures[0]; failed {
+			log.Printf("Failed to unsubscribe device %d from topic %s for tenant %s: %s", device.ID, subscription.Topic, tenantID, reason)
+		}
+	}
+
+	if len(subscriptions) > 0 {
+		log.Printf("Unsubscribed device %d from %d topic(s) for tenant %s", device.ID, len(subscriptions), tenantID)
+	}
+	return nil
+}
+
+// registeredDevices looks up the active Android registrations of the given tokens, recording
+// unknown tokens as failures in the returned result
+func (m *TopicManager) registeredDevices(tenantID, topic string, deviceTokens []string) ([]models.DeviceToken, *TopicResult, error) {
+	var devices []models.DeviceToken
+	if err := m.db.Where("tenant_id = ? AND platform = ? AND active = ? AND device_token IN ?",
+		tenantID, models.PlatformAndroid, true, deviceTokens).Find(&devices).Error; err != nil {
+		return nil, nil, err
+	}
+
+	known := make(map[string]bool, len(devices))
+	for _, device := range devices {
+		known[device.DeviceToken] = true
+	}
+
+	result := &TopicResult{Topic: topic}
+	for _, token := range deviceTokens {
+		if !known[token] {
+			result.Failures = append(result.Failures, TopicFailure{DeviceToken: token, Reason: "device not registered"})
+		}
+	}
+
+	return devices, result, nil
+}
+
+// apply sends the (un)subscribe request for devices to FCM and returns the devices it succeeded for
+func (m *TopicManager) apply(tenantID, topic string, devices []models.DeviceToken, result *TopicResult, subscribe bool) ([]models.DeviceToken, error) {
+	if len(devices) == 0 {
+		return nil, nil
+	}
+
+	tokens := make([]string, len(devices))
+	for i, device := range devices {
+		tokens[i] = device.DeviceToken
+	}
+
+	var failures map[int]string
+	var err error
+	if subscribe {
+		failures, err = m.fcm.SubscribeToTopic(tenantID, tokens, topic)
+	} else {
+		failures, err = m.fcm.UnsubscribeFromTopic(tenantID, tokens, topic)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var succeeded []models.DeviceToken
+	for i, device := range devices {
+		if reason, failed := failures[i]; failed {
+			result.Failures = append(result.Failures, TopicFailure{DeviceToken: device.DeviceToken, Reason: reason})
+			continue
+		}
+		succeeded = append(succeeded, device)
+	}
+
+	result.Succeeded = len(succeeded)
+	return succeeded, nil
+}
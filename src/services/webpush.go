@@ -0,0 +1,331 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gaulatti/signal/src/models"
+	"github.com/gaulatti/signal/src/storage"
+	"gorm.io/gorm"
+)
+
+// vapidTokenLifetime is how long VAPID JWTs are valid; RFC 8292 allows at most 24 hours
+const vapidTokenLifetime = 12 * time.Hour
+
+// WebPushClient holds a tenant's cached VAPID key and config
+type WebPushClient struct {
+	Config     *models.WebPushConfig
+	PrivateKey *ecdsa.PrivateKey
+	PublicKey  string // base64url uncompressed point, the browser's applicationServerKey
+	LastUsed   time.Time
+}
+
+// WebPushService delivers to browser push subscriptions using the Web Push protocol (RFC 8030)
+// with message encryption (RFC 8291) and VAPID authentication (RFC 8292)
+type WebPushService struct {
+	s3Service  *storage.S3Service
+	db         *gorm.DB
+	httpClient *http.Client
+	clients    map[string]*WebPushClient // tenantID -> client
+	mu         sync.Mutex
+}
+
+// NewWebPushService creates a new Web Push service instance
+func NewWebPushService(s3Service *storage.S3Service, db *gorm.DB) *WebPushService {
+	return &WebPushService{
+		s3Service:  s3Service,
+		db:         db,
+		httpClient: &http.Client{Timeout: 10 * time.Second, Transport: newWebPushTransport()},
+		clients:    make(map[string]*WebPushClient),
+	}
+}
+
+// newWebPushTransport returns a transport that only connects to public addresses. Proxies are
+// not used, since they would hide the address a push is sent to.
+func newWebPushTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   webPushDialControl,
+	}).DialContext
+	return transport
+}
+
+// Name returns the provider identifier
+func (s *WebPushService) Name() string {
+	return "webpush"
+}
+
+// getOrCreateClient gets or loads the VAPID key of a tenant. The cache is read under the write
+// lock because a hit updates LastUsed, which CleanupOldClients reads.
+func (s *WebPushService) getOrCreateClient(tenantID string) (*WebPushClient, error) {
+	s.mu.Lock()
+	if client, exists := s.clients[tenantID]; exists {
+		client.LastUsed = time.Now()
+		s.mu.Unlock()
+		return client, nil
+	}
+	s.mu.Unlock()
+
+	// Get Web Push config from database
+	var config models.WebPushConfig
+	if err := s.db.Where("tenant_id = ? AND active = ?", tenantID, true).First(&config).Error; err != nil {
+		return nil, fmt.Errorf("Web Push config not found for tenant %s: %w", tenantID, err)
+	}
+
+	// Download the VAPID private key from S3
+	pemKey := fmt.Sprintf("webpush/%s.pem", tenantID)
+	keyPEM, err := s.s3Service.GetFileContent(pemKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download VAPID key for tenant %s: %w", tenantID, err)
+	}
+
+	privateKey, err := parseVAPIDKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load VAPID key for tenant %s: %w", tenantID, err)
+	}
+
+	ecdhKey, err := privateKey.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load VAPID key for tenant %s: %w", tenantID, err)
+	}
+
+	webPushClient := &WebPushClient{
+		Config:     &config,
+		PrivateKey: privateKey,
+		PublicKey:  base64.RawURLEncoding.EncodeToString(ecdhKey.PublicKey().Bytes()),
+		LastUsed:   time.Now(),
+	}
+
+	// Cache the client
+	s.mu.Lock()
+	s.clients[tenantID] = webPushClient
+	s.mu.Unlock()
+
+	log.Printf("Created Web Push client for tenant %s (subject: %s)", tenantID, config.Subject)
+	return webPushClient, nil
+}
+
+// PublicKey returns the tenant's VAPID public key, which browsers pass to pushManager.subscribe
+// as the applicationServerKey
+func (s *WebPushService) PublicKey(tenantID string) (string, error) {
+	client, err := s.getOrCreateClient(tenantID)
+	if err != nil {
+		return "", err
+	}
+	return client.PublicKey, nil
+}
+
+// SendPush encrypts a message for a registered browser subscription and posts it to the
+// subscription's push service. The device token is the subscription endpoint.
+func (s *WebPushService) SendPush(tenantID, deviceToken string, msg *Message) (string, error) {
+	client, err := s.getOrCreateClient(tenantID)
+	if err != nil {
+		return "", err
+	}
+
+	subscription, err := models.GetWebPushSubscription(s.db, tenantID, deviceToken)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", &PushError{Provider: s.Name(), Reason: "subscription not registered", TokenInvalid: true, Err: err}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load web push subscription: %w", err)
+	}
+
+	payload, err := buildWebPushPayload(msg)
+	if err != nil {
+		return "", &PushError{Provider: s.Name(), Reason: err.Error(), Err: err}
+	}
+
+	body, err := encryptWebPush(payload, subscription.WebPushP256DH, subscription.WebPushAuth)
+	if err != nil {
+		return "", &PushError{Provider: s.Name(), Reason: err.Error(), TokenInvalid: true, Err: err}
+	}
+
+	authorization, err := s.vapidAuthorization(client, deviceToken)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, deviceToken, bytes.NewReader(body))
+	if err != nil {
+		return "", &PushError{Provider: s.Name(), Reason: err.Error(), TokenInvalid: true, Err: err}
+	}
+
+	for name, value := range webPushHeaders(msg) {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Authorization", authorization)
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", &PushError{Provider: s.Name(), Reason: err.Error(), Retryable: isNetworkTimeout(err), Err: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		reason, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		if len(reason) == 0 {
+			reason = []byte(http.StatusText(res.StatusCode))
+		}
+		return "", &PushError{
+			Provider:   s.Name(),
+			StatusCode: res.StatusCode,
+			Reason:     string(bytes.TrimSpace(reason)),
+			Retryable:  res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500,
+
+			// 404 and 410 mean the subscription expired or was revoked by the user
+			TokenInvalid: res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone,
+		}
+	}
+
+	// Push services return the message resource in Location
+	messageID := res.Header.Get("Location")
+	log.Printf("✅ Web Push sent successfully via tenant %s (status: %d)", tenantID, res.StatusCode)
+	return messageID, nil
+}
+
+// DryRun builds the Web Push request for a subscription without sending it. The preview holds
+// the payload before encryption.
+func (s *WebPushService) DryRun(tenantID, deviceToken string, msg *Message) (*PushPreview, error) {
+	if _, err := s.getOrCreateClient(tenantID); err != nil {
+		return nil, err
+	}
+
+	subscription, err := models.GetWebPushSubscription(s.db, tenantID, deviceToken)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, &PushError{Provider: s.Name(), Reason: "subscription not registered", TokenInvalid: true, Err: err}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load web push subscription: %w", err)
+	}
+
+	payload, err := buildWebPushPayload(msg)
+	if err != nil {
+		return nil, &PushError{Provider: s.Name(), Reason: err.Error(), Err: err}
+	}
+
+	// Encrypting proves the stored subscription keys are usable
+	if _, err := encryptWebPush(payload, subscription.WebPushP256DH, subscription.WebPushAuth); err != nil {
+		return nil, &PushError{Provider: s.Name(), Reason: err.Error(), TokenInvalid: true, Err: err}
+	}
+
+	return &PushPreview{Headers: webPushHeaders(msg), Payload: json.RawMessage(payload)}, nil
+}
+
+// webPushHeaders returns the push service headers of a message other than Authorization
+func webPushHeaders(msg *Message) map[string]string {
+	ttl := int64(maxWebPushTTL / time.Second)
+	headers := map[string]string{
+		"Content-Encoding": "aes128gcm",
+		"Content-Type":     "application/octet-stream",
+	}
+
+	if msg.WebPush != nil {
+		if msg.WebPush.TTL != nil {
+			ttl = *msg.WebPush.TTL
+		}
+		if msg.WebPush.Urgency != "" {
+			headers["Urgency"] = msg.WebPush.Urgency
+		}
+		if msg.WebPush.Topic != "" {
+			headers["Topic"] = msg.WebPush.Topic
+		}
+	}
+
+	headers["TTL"] = strconv.FormatInt(ttl, 10)
+	return headers
+}
+
+// vapidAuthorization builds the VAPID Authorization header for an endpoint: a JWT signed with
+// ES256 whose audience is the push service origin, and the public key that verifies it
+func (s *WebPushService) vapidAuthorization(client *WebPushClient, endpoint string) (string, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", &PushError{Provider: s.Name(), Reason: "invalid endpoint", TokenInvalid: true, Err: err}
+	}
+
+	header, _ := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"aud": parsed.Scheme + "://" + parsed.Host,
+		"exp": time.Now().Add(vapidTokenLifetime).Unix(),
+		"sub": client.Config.Subject,
+	})
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	r, sig, err := ecdsa.Sign(rand.Reader, client.PrivateKey, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign VAPID token: %w", err)
+	}
+
+	// JWS encodes ES256 signatures as the fixed-size concatenation r || s
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	sig.FillBytes(signature[32:])
+
+	jwt := signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+	return fmt.Sprintf("vapid t=%s, k=%s", jwt, client.PublicKey), nil
+}
+
+// parseVAPIDKey parses a PEM-encoded P-256 private key in SEC 1 ("EC PRIVATE KEY") or PKCS #8 form
+func parseVAPIDKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	var key *ecdsa.PrivateKey
+	if parsed, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		key = parsed
+	} else {
+		pkcs8, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported private key: %w", err)
+		}
+		ecKey, ok := pkcs8.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("VAPID key must be an EC key")
+		}
+		key = ecKey
+	}
+
+	if key.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("VAPID key must use the P-256 curve")
+	}
+	return key, nil
+}
+
+// CleanupOldClients removes unused clients from cache
+func (s *WebPushService) CleanupOldClients() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-1 * time.Hour)
+	for tenantID, client := range s.clients {
+		if client.LastUsed.Before(cutoff) {
+			delete(s.clients, tenantID)
+			log.Printf("Cleaned up unused Web Push client for tenant %s", tenantID)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Web Push limits. Push services accept at most 4096 bytes of encrypted content; the aes128gcm
+// header (86 bytes), the AEAD tag (16) and the padding delimiter (1) leave the rest for the payload.
+const (
+	maxWebPushPayload = 4096 - 86 - 16 - 1
+	maxWebPushTTL     = 28 * 24 * time.Hour
+	webPushRecordSize = 4096
+)
+
+// webPushTopicPattern matches the Topic header: up to 32 characters of the URL-safe base64 alphabet
+var webPushTopicPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// WebPushOptions holds the Web Push-specific fields of a push. Urgency, TTL and Topic are sent
+// to the push service; the rest is passed to the service worker in the payload.
+type WebPushOptions struct {
+	TTL     *int64 `json:"ttl,omitempty"`     // seconds the push service keeps the message; defaults to 4 weeks
+	Urgency string `json:"urgency,omitempty"` // very-low, low, normal or high
+	Topic   string `json:"topic,omitempty"`   // replaces an undelivered message with the same topic
+	Icon    string `json:"icon,omitempty"`
+	Badge   string `json:"badge,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+	URL     string `json:"url,omitempty"` // page the service worker opens when the notification is clicked
+}
+
+// Validate checks the options for values push services would reject
+func (o *WebPushOptions) Validate() error {
+	if o.TTL != nil && (*o.TTL < 0 || time.Duration(*o.TTL)*time.Second > maxWebPushTTL) {
+		return fmt.Errorf("ttl must be between 0 and %d seconds", int64(maxWebPushTTL/time.Second))
+	}
+
+	if o.Urgency != "" && !webpushUrgencies[o.Urgency] {
+		return fmt.Errorf("urgency must be one of very-low, low, normal, high")
+	}
+
+	if o.Topic != "" && !webPushTopicPattern.MatchString(o.Topic) {
+		return fmt.Errorf("topic must be 1 to 32 characters of [A-Za-z0-9_-]")
+	}
+
+	return nil
+}
+
+// WebPushSubscription is a browser PushSubscription as returned by PushSubscription.toJSON()
+type WebPushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256DH string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// Validate checks that the endpoint is a push service URL and the keys have the sizes RFC 8291
+// requires. Local endpoints are only accepted when AllowLocalWebPushEndpoints is set.
+func (s *WebPushSubscription) Validate() error {
+	if err := validateWebPushEndpoint(s.Endpoint); err != nil {
+		return err
+	}
+
+	p256dh, err := decodeBase64URL(s.Keys.P256DH)
+	if err != nil {
+		return fmt.Errorf("keys.p256dh must be base64url: %w", err)
+	}
+	if _, err := ecdh.P256().NewPublicKey(p256dh); err != nil {
+		return fmt.Errorf("keys.p256dh is not a P-256 public key")
+	}
+
+	auth, err := decodeBase64URL(s.Keys.Auth)
+	if err != nil || len(auth) != 16 {
+		return fmt.Errorf("keys.auth must be a 16-byte base64url secret")
+	}
+
+	return nil
+}
+
+// allowLocalWebPush accepts endpoints on local addresses, see AllowLocalWebPushEndpoints
+var allowLocalWebPush atomic.Bool
+
+// AllowLocalWebPushEndpoints sets whether Web Push endpoints may point at loopback, private or
+// link-local addresses, including plain http on loopback. It exists so a local stand-in push
+// service can be used in development; otherwise subscriptions could make the server send
+// requests to internal services.
+func AllowLocalWebPushEndpoints(allow bool) {
+	allowLocalWebPush.Store(allow)
+}
+
+// validateWebPushEndpoint checks that an endpoint is an absolute https URL on a public host that
+// fits the device token column
+func validateWebPushEndpoint(value string) error {
+	endpoint, err := url.Parse(value)
+	if err != nil || endpoint.Host == "" {
+		return fmt.Errorf("endpoint must be an absolute https URL")
+	}
+
+	local := isLocalHost(endpoint.Hostname())
+	if local && !allowLocalWebPush.Load() {
+		return fmt.Errorf("endpoint must not be a local or private address")
+	}
+	if endpoint.Scheme != "https" && !(endpoint.Scheme == "http" && local && isLoopbackHost(endpoint.Hostname())) {
+		return fmt.Errorf("endpoint must be an absolute https URL")
+	}
+
+	if len(value) > 500 {
+		return fmt.Errorf("endpoint must be at most 500 characters")
+	}
+	return nil
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback address
+func isLoopbackHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isLocalHost reports whether host is a loopback name or a literal address that is not publicly
+// routable
+func isLocalHost(host string) bool {
+	if isLoopbackHost(host) {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && isLocalIP(ip)
+}
+
+// isLocalIP reports whether ip is a loopback, private, link-local or unspecified address
+func isLocalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// webPushDialControl refuses connections to local addresses unless they are allowed. Endpoints
+// are checked when registered, but a public host name can still resolve to an internal address.
+func webPushDialControl(network, address string, _ syscall.RawConn) error {
+	if allowLocalWebPush.Load() {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isLocalIP(ip) {
+		return fmt.Errorf("refusing to connect to local address %s", host)
+	}
+	return nil
+}
+
+// decodeBase64URL decodes base64url with or without padding, as browsers produce either
+func decodeBase64URL(value string) ([]byte, error) {
+	if decoded, err := base64.RawURLEncoding.DecodeString(value); err == nil {
+		return decoded, nil
+	}
+	return base64.URLEncoding.DecodeString(value)
+}
+
+// webPushNotification is the JSON payload delivered to the service worker's push event
+type webPushNotification struct {
+	Title string                 `json:"title,omitempty"`
+	Body  string                 `json:"body,omitempty"`
+	Icon  string                 `json:"icon,omitempty"`
+	Badge string                 `json:"badge,omitempty"`
+	Tag   string                 `json:"tag,omitempty"`
+	URL   string                 `json:"url,omitempty"`
+	Data  map[string]interface{} `json:"data,omitempty"`
+}
+
+// buildWebPushPayload encodes the payload of a message for the service worker, fitting it into
+// the Web Push size limit
+func buildWebPushPayload(msg *Message) ([]byte, error) {
+	fitted, err := fitWebPushMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	return encodeWebPushPayload(fitted)
+}
+
+// encodeWebPushPayload encodes the JSON payload of a message without checking its size
+func encodeWebPushPayload(msg *Message) ([]byte, error) {
+	notification := webPushNotification{Title: msg.Title, Body: msg.Body, Data: msg.Data}
+	if options := msg.WebPush; options != nil {
+		notification.Icon = options.Icon
+		notification.Badge = options.Badge
+		notification.Tag = options.Tag
+		notification.URL = options.URL
+	}
+
+	payload, err := json.Marshal(&notification)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode web push payload: %w", err)
+	}
+	return payload, nil
+}
+
+// encryptWebPush encrypts a payload for a subscription with the aes128gcm content coding
+// (RFC 8188) using the key derivation of RFC 8291. The result is a single record whose header
+// carries the salt and the ephemeral public key.
+func encryptWebPush(plaintext []byte, p256dh, authSecret string) ([]byte, error) {
+	uaPublicBytes, err := decodeBase64URL(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh: %w", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh: %w", err)
+	}
+
+	auth, err := decodeBase64URL(authSecret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth secret: %w", err)
+	}
+
+	// A fresh sender key pair and salt for every message
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return sealWebPush(plaintext, uaPublic, auth, asPrivate, salt)
+}
+
+// sealWebPush encrypts a payload with a given sender key pair and salt; see encryptWebPush
+func sealWebPush(plaintext []byte, uaPublic *ecdh.PublicKey, auth []byte, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	uaPublicBytes := uaPublic.Bytes()
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	// IKM = HKDF(auth_secret, ecdh_secret, "WebPush: info" || 0x00 || ua_public || as_public, 32)
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublicBytes...), asPublic...)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, auth, string(keyInfo), 32)
+	if err != nil {
+		return nil, err
+	}
+
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// Header: salt (16) || record size (4) || key id length (1) || key id (the sender public key)
+	header := make([]byte, 0, 21+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	// The only record is the last one, so the plaintext ends with the 0x02 delimiter
+	record := append(append([]byte{}, plaintext...), 0x02)
+	return gcm.Seal(header, nonce, record, nil), nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"testing"
+)
+
+// TestSealWebPushRFC8291 encrypts the example message of RFC 8291, section 5, with the keys and
+// salt of the example and compares the result with the published ciphertext
+func TestSealWebPushRFC8291(t *testing.T) {
+	decode := func(value string) []byte {
+		t.Helper()
+		decoded, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			t.Fatalf("decode %q: %v", value, err)
+		}
+		return decoded
+	}
+
+	plaintext := []byte("When I grow up, I want to be a watermelon")
+	asPrivate, err := ecdh.P256().NewPrivateKey(decode("yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(decode("BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := decode("BTBZMqHH6r4Tts7J_aSIgg")
+	salt := decode("DGv6ra1nlYgDCS1FRnbzlw")
+
+	sealed, err := sealWebPush(plaintext, uaPublic, auth, asPrivate, salt)
+	if err != nil {
+		t.Fatalf("sealWebPush() error = %v", err)
+	}
+
+	want := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	if got := base64.RawURLEncoding.EncodeToString(sealed); got != want {
+		t.Errorf("sealWebPush() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestValidateWebPushEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint   string
+		allowLocal bool
+		wantErr    bool
+	}{
+		{endpoint: "https://fcm.googleapis.com/fcm/send/abc", wantErr: false},
+		{endpoint: "https://updates.push.services.mozilla.com/wpush/v2/abc", wantErr: false},
+		{endpoint: "http://fcm.googleapis.com/fcm/send/abc", wantErr: true},
+		{endpoint: "ftp://fcm.googleapis.com/abc", wantErr: true},
+		{endpoint: "/relative/path", wantErr: true},
+		{endpoint: "http://localhost:8080/push", wantErr: true},
+		{endpoint: "https://localhost/push", wantErr: true},
+		{endpoint: "https://127.0.0.1/push", wantErr: true},
+		{endpoint: "https://[::1]/push", wantErr: true},
+		{endpoint: "https://10.0.0.5/push", wantErr: true},
+		{endpoint: "https://192.168.1.10/push", wantErr: true},
+		{endpoint: "https://169.254.169.254/latest/meta-data", wantErr: true},
+		{endpoint: "https://0.0.0.0/push", wantErr: true},
+		{endpoint: "http://localhost:8080/push", allowLocal: true, wantErr: false},
+		{endpoint: "http://127.0.0.1:8080/push", allowLocal: true, wantErr: false},
+		{endpoint: "https://10.0.0.5/push", allowLocal: true, wantErr: false},
+		{endpoint: "http://10.0.0.5/push", allowLocal: true, wantErr: true},
+	}
+
+	defer AllowLocalWebPushEndpoints(false)
+	for _, tt := range tests {
+		AllowLocalWebPushEndpoints(tt.allowLocal)
+		err := validateWebPushEndpoint(tt.endpoint)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateWebPushEndpoint(%q) with allowLocal=%v error = %v, wantErr %v", tt.endpoint, tt.allowLocal, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWebPushDialControl(t *testing.T) {
+	tests := []struct {
+		address string
+		wantErr bool
+	}{
+		{address: "142.250.185.74:443", wantErr: false},
+		{address: "[2607:f8b0:4005:80b::200a]:443", wantErr: false},
+		{address: "127.0.0.1:443", wantErr: true},
+		{address: "[::1]:443", wantErr: true},
+		{address: "10.1.2.3:443", wantErr: true},
+		{address: "172.16.0.1:443", wantErr: true},
+		{address: "169.254.169.254:80", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := webPushDialControl("tcp", tt.address, nil)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("webPushDialControl(%q) error = %v, wantErr %v", tt.address, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestWebPushClientCacheConcurrency reads cached clients while the cleanup runs; under -race it
+// fails if a cache hit updates LastUsed without holding the lock
+func TestWebPushClientCacheConcurrency(t *testing.T) {
+	s := &WebPushService{clients: map[string]*WebPushClient{
+		"tenant": {LastUsed: time.Now()},
+	}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := s.getOrCreateClient("tenant"); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		s.CleanupOldClients()
+	}
+	wg.Wait()
+}
@@ -21,6 +21,16 @@ generate_digest() {
     echo -n "${api_key}${date}" | openssl md5 | awk '{print $2}'
 }
 
+# Test tokens in the formats /register accepts: 64 hex characters for APNS, and the
+# "<instance id>:APA91b..." shape of FCM registration tokens
+apns_test_token() {
+    openssl rand -hex 32
+}
+
+fcm_test_token() {
+    echo -n "$(openssl rand -hex 11):APA91b$(openssl rand -hex 67)"
+}
+
 # Function to make authenticated request
 auth_request() {
     local method=$1
@@ -49,7 +59,7 @@ usage() {
     echo "Commands:"
     echo "  health                 - Check service health"
     echo "  digest                 - Generate auth digest for today"
-    echo "  register <user_id>     - Register a device token"
+    echo "  register <user_id> [platform] - Register a test device token (ios or android, default ios)"
     echo "  push <user_id>         - Send push to specific user"
     echo "  push-apns <user_id>    - Send APNS push to specific user"
     echo "  push-fcm <user_id>     - Send FCM push to specific user"
@@ -99,14 +109,22 @@ case "$1" in
         fi
         
         user_id=$2
-        device_token="device_${user_id}_$(date +%s)"
+        platform=${3:-ios}
+        case "$platform" in
+            ios) device_token=$(apns_test_token) ;;
+            android) device_token=$(fcm_test_token) ;;
+            *)
+                echo -e "${RED}Error: platform must be ios or android${NC}"
+                exit 1
+                ;;
+        esac
         
-        echo -e "${BLUE}Registering device for user: $user_id${NC}"
+        echo -e "${BLUE}Registering $platform device for user: $user_id${NC}"
         
         data="{
             \"device_token\": \"$device_token\",
             \"user_id\": \"$user_id\",
-            \"platform\": \"ios\"
+            \"platform\": \"$platform\"
         }"
         
         response=$(auth_request "POST" "/register" "$data")
@@ -143,7 +161,7 @@ case "$1" in
         fi
         
         user_id=$2
-        device_token="ios_device_${user_id}_$(date +%s)"
+        device_token=$(apns_test_token)
         
         echo -e "${BLUE}Sending APNS push notification to user: $user_id${NC}"
         
@@ -167,7 +185,7 @@ case "$1" in
         fi
         
         user_id=$2
-        device_token="android_device_${user_id}_$(date +%s)"
+        device_token=$(fcm_test_token)
         
         echo -e "${BLUE}Sending FCM push notification to user: $user_id${NC}"
         